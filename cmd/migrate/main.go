@@ -0,0 +1,139 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/CuriosityMusicStreaming/ComponentsPool/pkg/infrastructure/mysql"
+)
+
+const usage = `Usage: migrate [flags] <command>
+
+Commands:
+  up              apply all pending migrations
+  down <steps>    roll back last steps migrations
+  to <version>    apply or roll back migrations up to version
+  status          print applied and pending migrations
+
+Flags:
+`
+
+type migrationsDir struct {
+	dir string
+}
+
+func (m migrationsDir) GetDir() http.FileSystem {
+	return http.Dir(m.dir)
+}
+
+func main() {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+
+	var dsn mysql.DSN
+	flags.StringVar(&dsn.User, "user", os.Getenv("DB_USER"), "database user, DB_USER by default")
+	flags.StringVar(&dsn.Password, "password", os.Getenv("DB_PASSWORD"), "database password, DB_PASSWORD by default")
+	flags.StringVar(&dsn.Host, "host", os.Getenv("DB_HOST"), "database host, DB_HOST by default")
+	flags.StringVar(&dsn.Database, "database", os.Getenv("DB_NAME"), "database name, DB_NAME by default")
+	rawDSN := flags.String("dsn", os.Getenv("DB_DSN"), "database DSN or mysql:// URL overriding other database flags, DB_DSN by default")
+	dir := flags.String("dir", "migrations", "directory with migrations")
+	dryRun := flags.Bool("dry-run", false, "print SQL without executing it")
+	_ = flags.Parse(os.Args[1:])
+
+	if *rawDSN != "" {
+		var err error
+		dsn, err = mysql.ParseDSN(*rawDSN)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	err := run(mysql.NewConnector(), dsn, migrationsDir{dir: *dir}, flags.Args(), *dryRun)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		flags.Usage()
+		os.Exit(1)
+	}
+}
+
+func run(connector mysql.Connector, dsn mysql.DSN, provider mysql.MigrationProvider, args []string, dryRun bool) error {
+	if len(args) == 0 {
+		return fmt.Errorf("command is required")
+	}
+
+	if args[0] == "status" {
+		return printStatus(connector, dsn, provider)
+	}
+
+	target, err := parseTarget(args)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		plan, planErr := connector.PlanMigration(dsn, provider, target)
+		if planErr != nil {
+			return planErr
+		}
+		return mysql.WriteMigrationPlan(os.Stdout, plan)
+	}
+
+	switch {
+	case target.Version != "":
+		return connector.MigrateTo(dsn, provider, target.Version)
+	case target.Direction == mysql.MigrationDown:
+		return connector.MigrateDown(dsn, provider, target.Steps)
+	default:
+		return connector.MigrateUp(dsn, provider)
+	}
+}
+
+func parseTarget(args []string) (mysql.MigrationTarget, error) {
+	switch args[0] {
+	case "up":
+		return mysql.MigrationTarget{Direction: mysql.MigrationUp}, nil
+	case "down":
+		if len(args) < 2 {
+			return mysql.MigrationTarget{}, fmt.Errorf("number of steps is required")
+		}
+		steps, err := strconv.Atoi(args[1])
+		if err != nil || steps <= 0 {
+			return mysql.MigrationTarget{}, fmt.Errorf("invalid number of steps %q", args[1])
+		}
+		return mysql.MigrationTarget{Direction: mysql.MigrationDown, Steps: steps}, nil
+	case "to":
+		if len(args) < 2 {
+			return mysql.MigrationTarget{}, fmt.Errorf("version is required")
+		}
+		return mysql.MigrationTarget{Version: args[1]}, nil
+	default:
+		return mysql.MigrationTarget{}, fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+func printStatus(connector mysql.Connector, dsn mysql.DSN, provider mysql.MigrationProvider) error {
+	statuses, err := connector.MigrationStatus(dsn, provider)
+	if err != nil {
+		return err
+	}
+
+	for _, status := range statuses {
+		state := "pending"
+		if status.Applied {
+			state = "applied " + status.AppliedAt.Format(time.RFC3339)
+		}
+		if status.Missing {
+			state += " (missing)"
+		}
+		fmt.Printf("%-50s %s\n", status.ID, state)
+	}
+	return nil
+}
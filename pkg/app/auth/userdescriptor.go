@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/google/uuid"
@@ -10,6 +11,17 @@ type UserDescriptor struct {
 	UserID uuid.UUID
 }
 
+type userDescriptorKey struct{}
+
+func WithUserDescriptor(ctx context.Context, descriptor UserDescriptor) context.Context {
+	return context.WithValue(ctx, userDescriptorKey{}, descriptor)
+}
+
+func UserDescriptorFromContext(ctx context.Context) (UserDescriptor, bool) {
+	descriptor, ok := ctx.Value(userDescriptorKey{}).(UserDescriptor)
+	return descriptor, ok
+}
+
 type UserDescriptorSerializer interface {
 	Serialize(UserDescriptor) (string, error)
 	Deserialize(value string) (UserDescriptor, error)
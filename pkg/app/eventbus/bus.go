@@ -3,6 +3,7 @@ package eventbus
 import (
 	"sort"
 	"sync"
+	"time"
 )
 
 type EventID string
@@ -33,6 +34,12 @@ type Bus interface {
 	BusPublisher
 }
 
+// InspectableBus is Bus which exposes its subscriptions and stats, e.g. for NewDebugHandler
+type InspectableBus interface {
+	Bus
+	BusInspector
+}
+
 type subscriptionInfo struct {
 	id       uint64
 	handler  EventHandler
@@ -45,11 +52,13 @@ type bus struct {
 	lock        sync.Mutex
 	nextID      uint64
 	subscribers map[EventID]subscriptionsInfoList
+	metrics     metrics
 }
 
-func NewBus() Bus {
+func NewBus() InspectableBus {
 	return &bus{
 		subscribers: make(map[EventID]subscriptionsInfoList),
+		metrics:     metrics{events: make(map[EventID]*eventMetrics)},
 	}
 }
 
@@ -99,18 +108,50 @@ func (b *bus) Publish(event Event) {
 		return infos[i].priority > infos[j].priority
 	})
 
+	b.metrics.recordPublish(event.ID())
+
 	for _, sub := range infos {
+		start := time.Now()
 		sub.handler(event)
+		b.metrics.recordHandler(event.ID(), time.Since(start))
 	}
 }
 
-func (b *bus) copySubscriptions(eventID EventID) subscriptionsInfoList {
+func (b *bus) Subscriptions() []EventSubscriptions {
 	b.lock.Lock()
 	defer b.lock.Unlock()
 
-	if infos, ok := b.subscribers[eventID]; ok {
-		return infos
+	result := make([]EventSubscriptions, 0, len(b.subscribers))
+	for eventID, infos := range b.subscribers {
+		priorities := make([]int, 0, len(infos))
+		for _, info := range infos {
+			priorities = append(priorities, info.priority)
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(priorities)))
+
+		result = append(result, EventSubscriptions{
+			EventID:     eventID,
+			Subscribers: len(infos),
+			Priorities:  priorities,
+		})
 	}
 
-	return subscriptionsInfoList{}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].EventID < result[j].EventID
+	})
+	return result
+}
+
+func (b *bus) Stats() []EventStats {
+	return b.metrics.stats()
+}
+
+func (b *bus) copySubscriptions(eventID EventID) subscriptionsInfoList {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	infos := b.subscribers[eventID]
+	result := make(subscriptionsInfoList, len(infos))
+	copy(result, infos)
+	return result
 }
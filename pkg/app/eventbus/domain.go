@@ -0,0 +1,76 @@
+package eventbus
+
+import (
+	"github.com/CuriosityMusicStreaming/ComponentsPool/pkg/domain"
+)
+
+type ErrorHandler func(err error)
+
+// DomainEvent carries domain.Event over the Bus
+type DomainEvent struct {
+	Event domain.Event
+}
+
+func (e DomainEvent) ID() EventID {
+	return EventID(e.Event.ID())
+}
+
+// BusEvent carries Event to domain.EventHandler
+type BusEvent struct {
+	Event Event
+}
+
+func (e BusEvent) ID() string {
+	return string(e.Event.ID())
+}
+
+// NewDomainEventHandler publishes handled domain events on the Bus
+func NewDomainEventHandler(publisher BusPublisher) domain.EventHandler {
+	return &domainEventHandler{publisher: publisher}
+}
+
+type domainEventHandler struct {
+	publisher BusPublisher
+}
+
+func (handler *domainEventHandler) Handle(event domain.Event) error {
+	handler.publisher.Publish(toBusEvent(event))
+	return nil
+}
+
+// NewDomainEventHandlerAdapter passes bus events to domain.EventHandler, errors are reported to errorHandler
+func NewDomainEventHandlerAdapter(handler domain.EventHandler, errorHandler ErrorHandler) EventHandler {
+	return func(event Event) {
+		err := handler.Handle(toDomainEvent(event))
+		if err != nil && errorHandler != nil {
+			errorHandler(err)
+		}
+	}
+}
+
+// SubscribeDispatcher subscribes domain.EventDispatcher for events with eventID
+func SubscribeDispatcher(subscriber BusSubscriber, eventID EventID, priority int, dispatcher domain.EventDispatcher, errorHandler ErrorHandler) Subscription {
+	return subscriber.Subscribe(eventID, priority, NewDomainEventHandlerAdapter(&dispatcherHandler{dispatcher: dispatcher}, errorHandler))
+}
+
+type dispatcherHandler struct {
+	dispatcher domain.EventDispatcher
+}
+
+func (handler *dispatcherHandler) Handle(event domain.Event) error {
+	return handler.dispatcher.Dispatch(event)
+}
+
+func toBusEvent(event domain.Event) Event {
+	if e, ok := event.(BusEvent); ok {
+		return e.Event
+	}
+	return DomainEvent{Event: event}
+}
+
+func toDomainEvent(event Event) domain.Event {
+	if e, ok := event.(DomainEvent); ok {
+		return e.Event
+	}
+	return BusEvent{Event: event}
+}
@@ -0,0 +1,118 @@
+package eventbus
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// handlerLatencyBuckets are upper bounds of handler latency histogram buckets, last bucket is unbounded
+var handlerLatencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+}
+
+type BusInspector interface {
+	Subscriptions() []EventSubscriptions
+	Stats() []EventStats
+}
+
+type EventSubscriptions struct {
+	EventID     EventID `json:"event_id"`
+	Subscribers int     `json:"subscribers"`
+	Priorities  []int   `json:"priorities"`
+}
+
+type EventStats struct {
+	EventID        EventID   `json:"event_id"`
+	Published      uint64    `json:"published"`
+	HandlerLatency Histogram `json:"handler_latency"`
+}
+
+type Histogram struct {
+	Count   uint64            `json:"count"`
+	Sum     time.Duration     `json:"sum"`
+	Buckets []HistogramBucket `json:"buckets"`
+}
+
+type HistogramBucket struct {
+	// UpperBound is zero for unbounded bucket
+	UpperBound time.Duration `json:"upper_bound"`
+	Count      uint64        `json:"count"`
+}
+
+type eventMetrics struct {
+	published uint64
+	count     uint64
+	sum       time.Duration
+	buckets   []uint64
+}
+
+type metrics struct {
+	lock   sync.Mutex
+	events map[EventID]*eventMetrics
+}
+
+func (m *metrics) recordPublish(eventID EventID) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.get(eventID).published++
+}
+
+func (m *metrics) recordHandler(eventID EventID, latency time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	em := m.get(eventID)
+	em.count++
+	em.sum += latency
+
+	bucket := sort.Search(len(handlerLatencyBuckets), func(i int) bool {
+		return latency <= handlerLatencyBuckets[i]
+	})
+	em.buckets[bucket]++
+}
+
+func (m *metrics) stats() []EventStats {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	result := make([]EventStats, 0, len(m.events))
+	for eventID, em := range m.events {
+		buckets := make([]HistogramBucket, len(em.buckets))
+		for i, count := range em.buckets {
+			if i < len(handlerLatencyBuckets) {
+				buckets[i].UpperBound = handlerLatencyBuckets[i]
+			}
+			buckets[i].Count = count
+		}
+
+		result = append(result, EventStats{
+			EventID:   eventID,
+			Published: em.published,
+			HandlerLatency: Histogram{
+				Count:   em.count,
+				Sum:     em.sum,
+				Buckets: buckets,
+			},
+		})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].EventID < result[j].EventID
+	})
+	return result
+}
+
+func (m *metrics) get(eventID EventID) *eventMetrics {
+	em, ok := m.events[eventID]
+	if !ok {
+		em = &eventMetrics{buckets: make([]uint64, len(handlerLatencyBuckets)+1)}
+		m.events[eventID] = em
+	}
+	return em
+}
@@ -0,0 +1,105 @@
+package eventbus
+
+import (
+	"context"
+	"sync"
+)
+
+// SubscribeOnce subscribes handler that is unsubscribed after first delivery
+func SubscribeOnce(subscriber BusSubscriber, eventID EventID, priority int, handler EventHandler) Subscription {
+	return subscribeScoped(context.Background(), subscriber, eventID, priority, handler, true)
+}
+
+// SubscribeContext subscribes handler that is unsubscribed when ctx is done
+func SubscribeContext(ctx context.Context, subscriber BusSubscriber, eventID EventID, priority int, handler EventHandler) Subscription {
+	return subscribeScoped(ctx, subscriber, eventID, priority, handler, false)
+}
+
+// WaitFor blocks until next event with eventID is published or ctx is done
+func WaitFor(ctx context.Context, subscriber BusSubscriber, eventID EventID) (Event, error) {
+	events := make(chan Event, 1)
+	subscribeScoped(ctx, subscriber, eventID, 0, func(event Event) {
+		events <- event
+	}, true)
+
+	select {
+	case event := <-events:
+		return event, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func subscribeScoped(ctx context.Context, subscriber BusSubscriber, eventID EventID, priority int, handler EventHandler, once bool) Subscription {
+	s := &scopedSubscription{
+		subscriber: subscriber,
+		doneChan:   make(chan struct{}),
+	}
+
+	subscription := subscriber.Subscribe(eventID, priority, func(event Event) {
+		if once {
+			if !s.close() {
+				return
+			}
+		} else if s.isDone() {
+			return
+		}
+		handler(event)
+	})
+	s.setSubscription(subscription)
+
+	if ctx.Done() != nil {
+		go func() {
+			select {
+			case <-ctx.Done():
+				s.close()
+			case <-s.doneChan:
+			}
+		}()
+	}
+
+	return subscription
+}
+
+type scopedSubscription struct {
+	lock         sync.Mutex
+	subscriber   BusSubscriber
+	subscription *Subscription
+	done         bool
+	doneChan     chan struct{}
+}
+
+func (s *scopedSubscription) setSubscription(subscription Subscription) {
+	s.lock.Lock()
+	s.subscription = &subscription
+	done := s.done
+	s.lock.Unlock()
+
+	if done {
+		s.subscriber.Unsubscribe(subscription)
+	}
+}
+
+func (s *scopedSubscription) isDone() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.done
+}
+
+// close returns false if subscription is already closed
+func (s *scopedSubscription) close() bool {
+	s.lock.Lock()
+	if s.done {
+		s.lock.Unlock()
+		return false
+	}
+	s.done = true
+	close(s.doneChan)
+	subscription := s.subscription
+	s.lock.Unlock()
+
+	if subscription != nil {
+		s.subscriber.Unsubscribe(*subscription)
+	}
+	return true
+}
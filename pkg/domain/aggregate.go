@@ -0,0 +1,72 @@
+package domain
+
+import "errors"
+
+// ErrVersionConflict is returned by repositories when aggregate was changed since it was loaded
+var ErrVersionConflict = errors.New("aggregate version conflict")
+
+type Aggregate interface {
+	PullEvents() []Event
+}
+
+// AggregateRoot is embedded into aggregates to record domain events and track optimistic lock version
+type AggregateRoot struct {
+	events  []Event
+	version int
+}
+
+func (a *AggregateRoot) RecordEvent(event Event) {
+	a.events = append(a.events, event)
+}
+
+// PullEvents returns recorded events and clears them
+func (a *AggregateRoot) PullEvents() []Event {
+	events := a.events
+	a.events = nil
+	return events
+}
+
+// Version is version of aggregate in storage at the moment of loading
+func (a *AggregateRoot) Version() int {
+	return a.version
+}
+
+func (a *AggregateRoot) SetVersion(version int) {
+	a.version = version
+}
+
+// NextVersion is version that should be stored on save
+func (a *AggregateRoot) NextVersion() int {
+	return a.version + 1
+}
+
+// UndispatchedEventsError is returned by DispatchEvents when dispatch fails.
+// Events are failed event and events after it, they are already pulled from aggregates so caller may dispatch them again
+type UndispatchedEventsError struct {
+	Events []Event
+	Err    error
+}
+
+func (e *UndispatchedEventsError) Error() string {
+	return "failed to dispatch events: " + e.Err.Error()
+}
+
+func (e *UndispatchedEventsError) Unwrap() error {
+	return e.Err
+}
+
+// DispatchEvents dispatches events recorded by aggregates, should be called after aggregates are persisted
+func DispatchEvents(dispatcher EventDispatcher, aggregates ...Aggregate) error {
+	var events []Event
+	for _, aggregate := range aggregates {
+		events = append(events, aggregate.PullEvents()...)
+	}
+
+	for i, event := range events {
+		err := dispatcher.Dispatch(event)
+		if err != nil {
+			return &UndispatchedEventsError{Events: events[i:], Err: err}
+		}
+	}
+	return nil
+}
@@ -1,6 +1,10 @@
 package activity
 
-import "github.com/google/uuid"
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
 
 type ID uuid.UUID
 
@@ -19,3 +23,14 @@ func ParseActivityID(value string) (ID, error) {
 func (i ID) String() string {
 	return uuid.UUID(i).String()
 }
+
+type activityIDKey struct{}
+
+func WithActivityID(ctx context.Context, id ID) context.Context {
+	return context.WithValue(ctx, activityIDKey{}, id)
+}
+
+func ActivityIDFromContext(ctx context.Context) (ID, bool) {
+	id, ok := ctx.Value(activityIDKey{}).(ID)
+	return id, ok
+}
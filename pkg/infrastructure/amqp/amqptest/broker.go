@@ -0,0 +1,736 @@
+package amqptest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	poolamqp "github.com/CuriosityMusicStreaming/ComponentsPool/pkg/infrastructure/amqp"
+	"github.com/google/uuid"
+	"github.com/streadway/amqp"
+)
+
+const (
+	messageTTLArg           = "x-message-ttl"
+	deadLetterExchangeArg   = "x-dead-letter-exchange"
+	deadLetterRoutingKeyArg = "x-dead-letter-routing-key"
+
+	reasonRejected = "rejected"
+	reasonExpired  = "expired"
+
+	directReplyQueue       = "amq.rabbitmq.reply-to"
+	directReplyQueuePrefix = directReplyQueue + "."
+)
+
+// Broker is in-memory AMQP broker for tests, it supports direct, fanout and topic exchanges, acks, nacks,
+// prefetch, message ttl, dead lettering, publisher confirms, mandatory returns and direct reply-to
+type Broker struct {
+	lock      sync.Mutex
+	cond      *sync.Cond
+	exchanges map[string]*exchange
+	queues    map[string]*queue
+}
+
+func NewBroker() *Broker {
+	b := &Broker{
+		exchanges: make(map[string]*exchange),
+		queues:    make(map[string]*queue),
+	}
+	b.cond = sync.NewCond(&b.lock)
+
+	for name, kind := range map[string]string{
+		"":           amqp.ExchangeDirect,
+		"amq.direct": amqp.ExchangeDirect,
+		"amq.fanout": amqp.ExchangeFanout,
+		"amq.topic":  amqp.ExchangeTopic,
+	} {
+		b.exchanges[name] = &exchange{name: name, kind: kind}
+	}
+	return b
+}
+
+// Channel opens new channel, every channel has own prefetch and unacked deliveries
+func (b *Broker) Channel() *Channel {
+	ch := &Channel{
+		broker:    b,
+		unacked:   make(map[uint64]*unackedMessage),
+		consumers: make(map[string]*consumer),
+		notifier:  newNotifier(),
+	}
+	go ch.notifier.run()
+	return ch
+}
+
+// ConnectChannels connects every connector to its own channel
+func (b *Broker) ConnectChannels(connectors ...poolamqp.ChannelConnector) error {
+	for _, connector := range connectors {
+		if err := connector.ConnectChannel(b.Channel()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MessageCount returns number of ready messages in queue, unacked messages are not counted
+func (b *Broker) MessageCount(queueName string) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if q, ok := b.queues[queueName]; ok {
+		return len(q.messages)
+	}
+	return 0
+}
+
+type exchange struct {
+	name     string
+	kind     string
+	bindings []binding
+}
+
+type binding struct {
+	queue string
+	key   string
+}
+
+type message struct {
+	exchange    string
+	routingKey  string
+	publishing  amqp.Publishing
+	redelivered bool
+	// expiresAt is zero for messages without ttl
+	expiresAt time.Time
+}
+
+type queue struct {
+	name       string
+	args       amqp.Table
+	autoDelete bool
+	ttl        time.Duration
+	messages   []*message
+	consumers  int
+}
+
+// routeLocked returns false when message is not routed to any queue
+func (b *Broker) routeLocked(exchangeName, key string, publishing amqp.Publishing) bool {
+	ex := b.exchanges[exchangeName]
+	if ex == nil {
+		return false
+	}
+
+	var queueNames []string
+	switch {
+	case ex.name == "":
+		queueNames = []string{key}
+	case ex.kind == amqp.ExchangeFanout:
+		for _, bind := range ex.bindings {
+			queueNames = append(queueNames, bind.queue)
+		}
+	case ex.kind == amqp.ExchangeTopic:
+		for _, bind := range ex.bindings {
+			if topicMatch(strings.Split(bind.key, "."), strings.Split(key, ".")) {
+				queueNames = append(queueNames, bind.queue)
+			}
+		}
+	default:
+		for _, bind := range ex.bindings {
+			if bind.key == key {
+				queueNames = append(queueNames, bind.queue)
+			}
+		}
+	}
+
+	routed := make(map[string]bool, len(queueNames))
+	for _, name := range queueNames {
+		q, ok := b.queues[name]
+		if !ok || routed[name] {
+			continue
+		}
+		routed[name] = true
+		b.enqueueLocked(q, &message{
+			exchange:   exchangeName,
+			routingKey: key,
+			publishing: publishing,
+		})
+	}
+	return len(routed) > 0
+}
+
+func (b *Broker) enqueueLocked(q *queue, m *message) {
+	ttl := q.ttl
+	if expiration, err := strconv.ParseInt(m.publishing.Expiration, 10, 64); err == nil {
+		messageTTL := time.Duration(expiration) * time.Millisecond
+		if ttl == 0 || messageTTL < ttl {
+			ttl = messageTTL
+		}
+	}
+
+	if ttl > 0 {
+		m.expiresAt = time.Now().Add(ttl)
+		time.AfterFunc(ttl, b.expireMessages)
+	}
+
+	q.messages = append(q.messages, m)
+	b.cond.Broadcast()
+}
+
+func (b *Broker) expireMessages() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := time.Now()
+	for _, q := range b.queues {
+		var alive []*message
+		var expired []*message
+		for _, m := range q.messages {
+			if !m.expiresAt.IsZero() && !m.expiresAt.After(now) {
+				expired = append(expired, m)
+			} else {
+				alive = append(alive, m)
+			}
+		}
+		q.messages = alive
+		for _, m := range expired {
+			b.deadLetterLocked(q, m, reasonExpired)
+		}
+	}
+}
+
+// deadLetterLocked republishes message to dead letter exchange of queue or drops it
+func (b *Broker) deadLetterLocked(q *queue, m *message, reason string) {
+	dlx, ok := q.args[deadLetterExchangeArg].(string)
+	if !ok {
+		return
+	}
+	key := m.routingKey
+	if dlk, ok := q.args[deadLetterRoutingKeyArg].(string); ok {
+		key = dlk
+	}
+
+	publishing := m.publishing
+	publishing.Expiration = ""
+	publishing.Headers = amqp.Table{}
+	for k, v := range m.publishing.Headers {
+		publishing.Headers[k] = v
+	}
+	if _, ok := publishing.Headers["x-first-death-queue"]; !ok {
+		publishing.Headers["x-first-death-queue"] = q.name
+		publishing.Headers["x-first-death-reason"] = reason
+		publishing.Headers["x-first-death-exchange"] = m.exchange
+	}
+
+	b.routeLocked(dlx, key, publishing)
+}
+
+func (b *Broker) deleteQueueLocked(q *queue) {
+	delete(b.queues, q.name)
+	for _, ex := range b.exchanges {
+		bindings := ex.bindings[:0]
+		for _, bind := range ex.bindings {
+			if bind.queue != q.name {
+				bindings = append(bindings, bind)
+			}
+		}
+		ex.bindings = bindings
+	}
+}
+
+// Channel implements poolamqp.BrokerChannel and amqp.Acknowledger of its deliveries
+type Channel struct {
+	broker    *Broker
+	closed    bool
+	prefetch  int
+	nextTag   uint64
+	unacked   map[uint64]*unackedMessage
+	consumers map[string]*consumer
+	notifier  *notifier
+	// confirm is true in confirm mode, publishSeq is delivery tag of last published message in this mode
+	confirm    bool
+	publishSeq uint64
+	// replyQueue is queue of direct reply-to consumer of channel
+	replyQueue string
+}
+
+var _ poolamqp.BrokerChannel = (*Channel)(nil)
+
+type unackedMessage struct {
+	message *message
+	queue   *queue
+}
+
+type consumer struct {
+	tag      string
+	queue    *queue
+	autoAck  bool
+	canceled bool
+	stop     chan struct{}
+}
+
+func (ch *Channel) ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error {
+	b := ch.broker
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+
+	switch kind {
+	case amqp.ExchangeDirect, amqp.ExchangeFanout, amqp.ExchangeTopic:
+	default:
+		return newError(amqp.NotImplemented, "exchange kind %s is not supported", kind)
+	}
+
+	if ex, ok := b.exchanges[name]; ok {
+		if ex.kind != kind {
+			return newError(amqp.PreconditionFailed, "exchange %s is declared with kind %s", name, ex.kind)
+		}
+		return nil
+	}
+
+	b.exchanges[name] = &exchange{name: name, kind: kind}
+	return nil
+}
+
+func (ch *Channel) QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error) {
+	b := ch.broker
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if ch.closed {
+		return amqp.Queue{}, amqp.ErrClosed
+	}
+
+	if name == "" {
+		name = "amq.gen-" + uuid.New().String()
+	}
+
+	q, ok := b.queues[name]
+	if !ok {
+		q = &queue{
+			name:       name,
+			args:       args,
+			autoDelete: autoDelete,
+			ttl:        tableDuration(args, messageTTLArg),
+		}
+		b.queues[name] = q
+	}
+
+	return amqp.Queue{Name: q.name, Messages: len(q.messages), Consumers: q.consumers}, nil
+}
+
+func (ch *Channel) QueueBind(name, key, exchangeName string, noWait bool, args amqp.Table) error {
+	b := ch.broker
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+
+	ex, ok := b.exchanges[exchangeName]
+	if !ok {
+		return newError(amqp.NotFound, "no exchange %s", exchangeName)
+	}
+	if ex.name == "" {
+		return newError(amqp.AccessRefused, "binding to default exchange is not allowed")
+	}
+	if _, ok := b.queues[name]; !ok {
+		return newError(amqp.NotFound, "no queue %s", name)
+	}
+
+	for _, bind := range ex.bindings {
+		if bind.queue == name && bind.key == key {
+			return nil
+		}
+	}
+	ex.bindings = append(ex.bindings, binding{queue: name, key: key})
+	return nil
+}
+
+func (ch *Channel) Qos(prefetchCount, prefetchSize int, global bool) error {
+	b := ch.broker
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	ch.prefetch = prefetchCount
+	b.cond.Broadcast()
+	return nil
+}
+
+// Publish sends return of unroutable mandatory message before its confirmation, as RabbitMQ does
+func (ch *Channel) Publish(exchangeName, key string, mandatory, immediate bool, msg amqp.Publishing) error {
+	b := ch.broker
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	if _, ok := b.exchanges[exchangeName]; !ok {
+		return newError(amqp.NotFound, "no exchange %s", exchangeName)
+	}
+	if msg.ReplyTo == directReplyQueue {
+		if ch.replyQueue == "" {
+			return newError(amqp.PreconditionFailed, "fast reply consumer does not exist")
+		}
+		msg.ReplyTo = ch.replyQueue
+	}
+
+	routed := b.routeLocked(exchangeName, key, msg)
+	if mandatory && !routed {
+		ch.notifier.push(newReturn(exchangeName, key, msg))
+	}
+	if ch.confirm {
+		ch.publishSeq++
+		ch.notifier.push(amqp.Confirmation{DeliveryTag: ch.publishSeq, Ack: true})
+	}
+	return nil
+}
+
+func (ch *Channel) Confirm(noWait bool) error {
+	b := ch.broker
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	ch.confirm = true
+	return nil
+}
+
+// NotifyPublish registers listener for confirmations, it is closed when channel is closed
+func (ch *Channel) NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation {
+	ch.notifier.addConfirmListener(confirm)
+	return confirm
+}
+
+// NotifyReturn registers listener for returned mandatory messages, it is closed when channel is closed
+func (ch *Channel) NotifyReturn(c chan amqp.Return) chan amqp.Return {
+	ch.notifier.addReturnListener(c)
+	return c
+}
+
+func (ch *Channel) Consume(queueName, consumerTag string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error) {
+	b := ch.broker
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if ch.closed {
+		return nil, amqp.ErrClosed
+	}
+
+	if queueName == directReplyQueue {
+		if !autoAck {
+			return nil, newError(amqp.PreconditionFailed, "direct reply-to requires no-ack mode")
+		}
+		if ch.replyQueue != "" {
+			return nil, newError(amqp.PreconditionFailed, "direct reply-to consumer already exists")
+		}
+		queueName = directReplyQueuePrefix + uuid.New().String()
+		b.queues[queueName] = &queue{name: queueName, autoDelete: true}
+		ch.replyQueue = queueName
+	}
+
+	q, ok := b.queues[queueName]
+	if !ok {
+		return nil, newError(amqp.NotFound, "no queue %s", queueName)
+	}
+	if consumerTag == "" {
+		consumerTag = "ctag-" + uuid.New().String()
+	}
+	if _, ok := ch.consumers[consumerTag]; ok {
+		return nil, newError(amqp.NotAllowed, "consumer %s already exists", consumerTag)
+	}
+
+	c := &consumer{
+		tag:     consumerTag,
+		queue:   q,
+		autoAck: autoAck,
+		stop:    make(chan struct{}),
+	}
+	ch.consumers[consumerTag] = c
+	q.consumers++
+
+	deliveries := make(chan amqp.Delivery)
+	go ch.deliver(c, deliveries)
+
+	return deliveries, nil
+}
+
+func (ch *Channel) Cancel(consumerTag string, noWait bool) error {
+	b := ch.broker
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	c, ok := ch.consumers[consumerTag]
+	if !ok {
+		return newError(amqp.NotFound, "no consumer %s", consumerTag)
+	}
+	ch.cancelLocked(c)
+	return nil
+}
+
+// Close cancels consumers and requeues unacked deliveries
+func (ch *Channel) Close() error {
+	b := ch.broker
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if ch.closed {
+		return amqp.ErrClosed
+	}
+	ch.closed = true
+
+	for _, c := range ch.consumers {
+		ch.cancelLocked(c)
+	}
+
+	tags := make([]uint64, 0, len(ch.unacked))
+	for tag := range ch.unacked {
+		tags = append(tags, tag)
+	}
+	ch.requeueLocked(tags)
+
+	ch.notifier.close()
+	return nil
+}
+
+func (ch *Channel) Ack(tag uint64, multiple bool) error {
+	b := ch.broker
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	tags, err := ch.unackedTagsLocked(tag, multiple)
+	if err != nil {
+		return err
+	}
+	for _, t := range tags {
+		delete(ch.unacked, t)
+	}
+	b.cond.Broadcast()
+	return nil
+}
+
+func (ch *Channel) Nack(tag uint64, multiple, requeue bool) error {
+	b := ch.broker
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	tags, err := ch.unackedTagsLocked(tag, multiple)
+	if err != nil {
+		return err
+	}
+
+	if requeue {
+		ch.requeueLocked(tags)
+		return nil
+	}
+
+	for _, t := range tags {
+		unacked := ch.unacked[t]
+		delete(ch.unacked, t)
+		b.deadLetterLocked(unacked.queue, unacked.message, reasonRejected)
+	}
+	b.cond.Broadcast()
+	return nil
+}
+
+func (ch *Channel) Reject(tag uint64, requeue bool) error {
+	return ch.Nack(tag, false, requeue)
+}
+
+func (ch *Channel) deliver(c *consumer, deliveries chan<- amqp.Delivery) {
+	defer close(deliveries)
+
+	b := ch.broker
+	for {
+		b.lock.Lock()
+		var delivery amqp.Delivery
+		for {
+			if c.canceled {
+				b.lock.Unlock()
+				return
+			}
+			var ok bool
+			if delivery, ok = ch.takeLocked(c); ok {
+				break
+			}
+			b.cond.Wait()
+		}
+		b.lock.Unlock()
+
+		select {
+		case deliveries <- delivery:
+		case <-c.stop:
+			if !c.autoAck {
+				b.lock.Lock()
+				ch.requeueLocked([]uint64{delivery.DeliveryTag})
+				b.lock.Unlock()
+			}
+			return
+		}
+	}
+}
+
+func (ch *Channel) takeLocked(c *consumer) (amqp.Delivery, bool) {
+	q := c.queue
+	if len(q.messages) == 0 {
+		return amqp.Delivery{}, false
+	}
+	if !c.autoAck && ch.prefetch > 0 && len(ch.unacked) >= ch.prefetch {
+		return amqp.Delivery{}, false
+	}
+
+	m := q.messages[0]
+	q.messages = q.messages[1:]
+
+	ch.nextTag++
+	if !c.autoAck {
+		ch.unacked[ch.nextTag] = &unackedMessage{message: m, queue: q}
+	}
+
+	p := m.publishing
+	return amqp.Delivery{
+		Acknowledger:    ch,
+		Headers:         p.Headers,
+		ContentType:     p.ContentType,
+		ContentEncoding: p.ContentEncoding,
+		DeliveryMode:    p.DeliveryMode,
+		Priority:        p.Priority,
+		CorrelationId:   p.CorrelationId,
+		ReplyTo:         p.ReplyTo,
+		Expiration:      p.Expiration,
+		MessageId:       p.MessageId,
+		Timestamp:       p.Timestamp,
+		Type:            p.Type,
+		UserId:          p.UserId,
+		AppId:           p.AppId,
+		ConsumerTag:     c.tag,
+		DeliveryTag:     ch.nextTag,
+		Redelivered:     m.redelivered,
+		Exchange:        m.exchange,
+		RoutingKey:      m.routingKey,
+		Body:            p.Body,
+	}, true
+}
+
+func (ch *Channel) cancelLocked(c *consumer) {
+	b := ch.broker
+	c.canceled = true
+	close(c.stop)
+	delete(ch.consumers, c.tag)
+
+	c.queue.consumers--
+	if c.queue.autoDelete && c.queue.consumers == 0 {
+		b.deleteQueueLocked(c.queue)
+	}
+	if c.queue.name == ch.replyQueue {
+		ch.replyQueue = ""
+	}
+	b.cond.Broadcast()
+}
+
+// requeueLocked returns messages to head of their queues in delivery order
+func (ch *Channel) requeueLocked(tags []uint64) {
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i] > tags[j]
+	})
+	for _, tag := range tags {
+		unacked, ok := ch.unacked[tag]
+		if !ok {
+			continue
+		}
+		delete(ch.unacked, tag)
+		unacked.message.redelivered = true
+		q := unacked.queue
+		q.messages = append([]*message{unacked.message}, q.messages...)
+	}
+	ch.broker.cond.Broadcast()
+}
+
+func (ch *Channel) unackedTagsLocked(tag uint64, multiple bool) ([]uint64, error) {
+	if !multiple {
+		if _, ok := ch.unacked[tag]; !ok {
+			return nil, newError(amqp.PreconditionFailed, "unknown delivery tag %d", tag)
+		}
+		return []uint64{tag}, nil
+	}
+
+	var tags []uint64
+	for t := range ch.unacked {
+		if t <= tag {
+			tags = append(tags, t)
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i] < tags[j]
+	})
+	return tags, nil
+}
+
+func newReturn(exchangeName, key string, p amqp.Publishing) amqp.Return {
+	return amqp.Return{
+		ReplyCode:       amqp.NoRoute,
+		ReplyText:       "NO_ROUTE",
+		Exchange:        exchangeName,
+		RoutingKey:      key,
+		ContentType:     p.ContentType,
+		ContentEncoding: p.ContentEncoding,
+		Headers:         p.Headers,
+		DeliveryMode:    p.DeliveryMode,
+		Priority:        p.Priority,
+		CorrelationId:   p.CorrelationId,
+		ReplyTo:         p.ReplyTo,
+		Expiration:      p.Expiration,
+		MessageId:       p.MessageId,
+		Timestamp:       p.Timestamp,
+		Type:            p.Type,
+		UserId:          p.UserId,
+		AppId:           p.AppId,
+		Body:            p.Body,
+	}
+}
+
+func topicMatch(pattern, key []string) bool {
+	if len(pattern) == 0 {
+		return len(key) == 0
+	}
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(key); i++ {
+			if topicMatch(pattern[1:], key[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(key) > 0 && topicMatch(pattern[1:], key[1:])
+	default:
+		return len(key) > 0 && key[0] == pattern[0] && topicMatch(pattern[1:], key[1:])
+	}
+}
+
+func tableDuration(args amqp.Table, key string) time.Duration {
+	var ms int64
+	switch value := args[key].(type) {
+	case int:
+		ms = int64(value)
+	case int32:
+		ms = int64(value)
+	case int64:
+		ms = value
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+func newError(code int, format string, args ...interface{}) *amqp.Error {
+	return &amqp.Error{
+		Code:   code,
+		Reason: fmt.Sprintf(format, args...),
+	}
+}
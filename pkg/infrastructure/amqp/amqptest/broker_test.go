@@ -0,0 +1,321 @@
+package amqptest
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+const testTimeout = time.Second
+
+func TestTopicExchangeRoutesByPattern(t *testing.T) {
+	ch := NewBroker().Channel()
+	mustDeclareExchange(t, ch, "events", amqp.ExchangeTopic)
+
+	bindings := map[string]string{
+		"single": "user.*",
+		"multi":  "user.#",
+		"all":    "#",
+		"exact":  "user.created.v2",
+		"other":  "track.*",
+	}
+	for queueName, key := range bindings {
+		mustDeclareQueue(t, ch, queueName, nil)
+		mustBind(t, ch, queueName, key, "events")
+	}
+
+	mustPublish(t, ch, "events", "user.created", amqp.Publishing{})
+	mustPublish(t, ch, "events", "user.created.v2", amqp.Publishing{})
+
+	expected := map[string]int{"single": 1, "multi": 2, "all": 2, "exact": 1, "other": 0}
+	for queueName, count := range expected {
+		if actual := ch.broker.MessageCount(queueName); actual != count {
+			t.Errorf("queue %s: expected %d messages, got %d", queueName, count, actual)
+		}
+	}
+}
+
+func TestTopicMatch(t *testing.T) {
+	cases := []struct {
+		pattern string
+		key     string
+		match   bool
+	}{
+		{"a.b", "a.b", true},
+		{"a.b", "a.c", false},
+		{"a.*", "a.b", true},
+		{"a.*", "a", false},
+		{"a.*", "a.b.c", false},
+		{"a.#", "a", true},
+		{"a.#", "a.b.c", true},
+		{"#.c", "a.b.c", true},
+		{"#.c", "a.b", false},
+		{"a.#.d", "a.b.c.d", true},
+		{"*.*", "a", false},
+	}
+	for _, c := range cases {
+		if actual := topicMatch(strings.Split(c.pattern, "."), strings.Split(c.key, ".")); actual != c.match {
+			t.Errorf("pattern %s, key %s: expected %v", c.pattern, c.key, c.match)
+		}
+	}
+}
+
+func TestFanoutAndDirectExchanges(t *testing.T) {
+	ch := NewBroker().Channel()
+	mustDeclareExchange(t, ch, "fanout", amqp.ExchangeFanout)
+	mustDeclareExchange(t, ch, "direct", amqp.ExchangeDirect)
+	for _, queueName := range []string{"first", "second"} {
+		mustDeclareQueue(t, ch, queueName, nil)
+		mustBind(t, ch, queueName, "ignored", "fanout")
+		mustBind(t, ch, queueName, queueName, "direct")
+	}
+
+	mustPublish(t, ch, "fanout", "any", amqp.Publishing{})
+	mustPublish(t, ch, "direct", "first", amqp.Publishing{})
+	mustPublish(t, ch, "", "second", amqp.Publishing{})
+
+	if count := ch.broker.MessageCount("first"); count != 2 {
+		t.Errorf("expected 2 messages in first, got %d", count)
+	}
+	if count := ch.broker.MessageCount("second"); count != 2 {
+		t.Errorf("expected 2 messages in second, got %d", count)
+	}
+}
+
+func TestNackWithRequeueRedeliversMessage(t *testing.T) {
+	ch := NewBroker().Channel()
+	mustDeclareQueue(t, ch, "queue", nil)
+	mustPublish(t, ch, "", "queue", amqp.Publishing{Body: []byte("message")})
+
+	deliveries := mustConsume(t, ch, "queue", false)
+	delivery := receiveDelivery(t, deliveries)
+	if delivery.Redelivered {
+		t.Fatal("first delivery is marked as redelivered")
+	}
+	if err := delivery.Nack(false, true); err != nil {
+		t.Fatal(err)
+	}
+
+	delivery = receiveDelivery(t, deliveries)
+	if !delivery.Redelivered || string(delivery.Body) != "message" {
+		t.Fatalf("unexpected redelivery %+v", delivery)
+	}
+	if err := delivery.Ack(false); err != nil {
+		t.Fatal(err)
+	}
+	if err := delivery.Ack(false); err == nil {
+		t.Fatal("second ack of delivery succeeded")
+	}
+}
+
+func TestRejectDeadLettersMessage(t *testing.T) {
+	ch := NewBroker().Channel()
+	mustDeclareExchange(t, ch, "dlx", amqp.ExchangeDirect)
+	mustDeclareQueue(t, ch, "dead", nil)
+	mustBind(t, ch, "dead", "work", "dlx")
+	mustDeclareQueue(t, ch, "work", amqp.Table{deadLetterExchangeArg: "dlx"})
+	mustPublish(t, ch, "", "work", amqp.Publishing{})
+
+	delivery := receiveDelivery(t, mustConsume(t, ch, "work", false))
+	if err := delivery.Reject(false); err != nil {
+		t.Fatal(err)
+	}
+
+	dead := receiveDelivery(t, mustConsume(t, ch, "dead", true))
+	if dead.Headers["x-first-death-reason"] != reasonRejected || dead.Headers["x-first-death-queue"] != "work" {
+		t.Fatalf("unexpected dead letter headers %v", dead.Headers)
+	}
+}
+
+func TestExpiredMessageIsDeadLettered(t *testing.T) {
+	ch := NewBroker().Channel()
+	mustDeclareQueue(t, ch, "target", nil)
+	mustDeclareQueue(t, ch, "wait", amqp.Table{
+		messageTTLArg:           int64(20),
+		deadLetterExchangeArg:   "",
+		deadLetterRoutingKeyArg: "target",
+	})
+	mustPublish(t, ch, "", "wait", amqp.Publishing{Body: []byte("delayed")})
+
+	if count := ch.broker.MessageCount("wait"); count != 1 {
+		t.Fatalf("expected message to wait, got %d messages", count)
+	}
+
+	delivery := receiveDelivery(t, mustConsume(t, ch, "target", true))
+	if string(delivery.Body) != "delayed" || delivery.Headers["x-first-death-reason"] != reasonExpired {
+		t.Fatalf("unexpected delivery %+v", delivery)
+	}
+	if count := ch.broker.MessageCount("wait"); count != 0 {
+		t.Fatalf("expected expired message to be removed, got %d messages", count)
+	}
+}
+
+func TestPrefetchLimitsUnackedDeliveries(t *testing.T) {
+	ch := NewBroker().Channel()
+	mustDeclareQueue(t, ch, "queue", nil)
+	if err := ch.Qos(1, 0, false); err != nil {
+		t.Fatal(err)
+	}
+	mustPublish(t, ch, "", "queue", amqp.Publishing{})
+	mustPublish(t, ch, "", "queue", amqp.Publishing{})
+
+	deliveries := mustConsume(t, ch, "queue", false)
+	first := receiveDelivery(t, deliveries)
+
+	select {
+	case <-deliveries:
+		t.Fatal("delivery exceeds prefetch count")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := first.Ack(false); err != nil {
+		t.Fatal(err)
+	}
+	receiveDelivery(t, deliveries)
+}
+
+func TestCloseRequeuesUnackedDeliveries(t *testing.T) {
+	broker := NewBroker()
+	ch := broker.Channel()
+	mustDeclareQueue(t, ch, "queue", nil)
+	mustPublish(t, ch, "", "queue", amqp.Publishing{})
+	receiveDelivery(t, mustConsume(t, ch, "queue", false))
+
+	if err := ch.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if count := broker.MessageCount("queue"); count != 1 {
+		t.Fatalf("expected unacked message to be requeued, got %d messages", count)
+	}
+	if err := ch.Publish("", "queue", false, false, amqp.Publishing{}); err != amqp.ErrClosed {
+		t.Fatalf("expected ErrClosed, got %v", err)
+	}
+}
+
+func TestConfirmModeSendsReturnBeforeAck(t *testing.T) {
+	ch := NewBroker().Channel()
+	mustDeclareQueue(t, ch, "queue", nil)
+	if err := ch.Confirm(false); err != nil {
+		t.Fatal(err)
+	}
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation))
+	returns := ch.NotifyReturn(make(chan amqp.Return))
+
+	mustPublish(t, ch, "", "queue", amqp.Publishing{})
+	if confirmation := receiveConfirmation(t, confirms); confirmation.DeliveryTag != 1 || !confirmation.Ack {
+		t.Fatalf("unexpected confirmation %+v", confirmation)
+	}
+
+	err := ch.Publish("", "missing", true, false, amqp.Publishing{MessageId: "unroutable"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case ret := <-returns:
+		if ret.MessageId != "unroutable" || ret.ReplyCode != amqp.NoRoute {
+			t.Fatalf("unexpected return %+v", ret)
+		}
+	case <-confirms:
+		t.Fatal("confirmation is sent before return")
+	case <-time.After(testTimeout):
+		t.Fatal("return is not received")
+	}
+	if confirmation := receiveConfirmation(t, confirms); confirmation.DeliveryTag != 2 || !confirmation.Ack {
+		t.Fatalf("unexpected confirmation %+v", confirmation)
+	}
+
+	if err := ch.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := <-confirms; ok {
+		t.Fatal("confirmations are not closed with channel")
+	}
+}
+
+func TestDirectReplyTo(t *testing.T) {
+	broker := NewBroker()
+	server := broker.Channel()
+	client := broker.Channel()
+	mustDeclareQueue(t, server, "requests", nil)
+
+	err := client.Publish("", "requests", false, false, amqp.Publishing{ReplyTo: directReplyQueue})
+	if err == nil {
+		t.Fatal("publish with direct reply-to succeeded without reply consumer")
+	}
+
+	replies := mustConsume(t, client, directReplyQueue, true)
+	mustPublish(t, client, "", "requests", amqp.Publishing{ReplyTo: directReplyQueue, CorrelationId: "id"})
+
+	request := receiveDelivery(t, mustConsume(t, server, "requests", true))
+	if request.ReplyTo == directReplyQueue {
+		t.Fatal("reply-to is not replaced with queue of client channel")
+	}
+	mustPublish(t, server, "", request.ReplyTo, amqp.Publishing{CorrelationId: request.CorrelationId, Body: []byte("reply")})
+
+	reply := receiveDelivery(t, replies)
+	if reply.CorrelationId != "id" || string(reply.Body) != "reply" {
+		t.Fatalf("unexpected reply %+v", reply)
+	}
+}
+
+func mustDeclareExchange(t *testing.T, ch *Channel, name, kind string) {
+	t.Helper()
+	if err := ch.ExchangeDeclare(name, kind, true, false, false, false, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustDeclareQueue(t *testing.T, ch *Channel, name string, args amqp.Table) {
+	t.Helper()
+	if _, err := ch.QueueDeclare(name, true, false, false, false, args); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustBind(t *testing.T, ch *Channel, queueName, key, exchangeName string) {
+	t.Helper()
+	if err := ch.QueueBind(queueName, key, exchangeName, false, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustPublish(t *testing.T, ch *Channel, exchangeName, key string, msg amqp.Publishing) {
+	t.Helper()
+	if err := ch.Publish(exchangeName, key, false, false, msg); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustConsume(t *testing.T, ch *Channel, queueName string, autoAck bool) <-chan amqp.Delivery {
+	t.Helper()
+	deliveries, err := ch.Consume(queueName, "", autoAck, false, false, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return deliveries
+}
+
+func receiveDelivery(t *testing.T, deliveries <-chan amqp.Delivery) amqp.Delivery {
+	t.Helper()
+	select {
+	case delivery := <-deliveries:
+		return delivery
+	case <-time.After(testTimeout):
+		t.Fatal("delivery is not received")
+		return amqp.Delivery{}
+	}
+}
+
+func receiveConfirmation(t *testing.T, confirms <-chan amqp.Confirmation) amqp.Confirmation {
+	t.Helper()
+	select {
+	case confirmation := <-confirms:
+		return confirmation
+	case <-time.After(testTimeout):
+		t.Fatal("confirmation is not received")
+		return amqp.Confirmation{}
+	}
+}
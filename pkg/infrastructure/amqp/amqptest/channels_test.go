@@ -0,0 +1,203 @@
+package amqptest_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/CuriosityMusicStreaming/ComponentsPool/pkg/app/auth"
+	"github.com/CuriosityMusicStreaming/ComponentsPool/pkg/app/eventbus"
+	poolamqp "github.com/CuriosityMusicStreaming/ComponentsPool/pkg/infrastructure/amqp"
+	"github.com/CuriosityMusicStreaming/ComponentsPool/pkg/infrastructure/amqp/amqptest"
+	"github.com/streadway/amqp"
+)
+
+const testTimeout = time.Second
+
+func TestRPCCallThroughBroker(t *testing.T) {
+	broker := amqptest.NewBroker()
+	topology := poolamqp.NewTopologyChannel(poolamqp.Topology{
+		Queues: []poolamqp.Queue{{Name: "rpc"}},
+	})
+	server := poolamqp.NewRPCServer(poolamqp.RPCServerConfig{Queue: "rpc"}, func(ctx context.Context, request poolamqp.RPCRequest) (poolamqp.RPCResponse, error) {
+		return poolamqp.RPCResponse{Body: append([]byte("echo "), request.Body...)}, nil
+	}, nil, testLogger{t})
+	client := poolamqp.NewRPCClient(poolamqp.RPCClientConfig{Timeout: testTimeout}, nil)
+
+	if err := broker.ConnectChannels(topology, server, client); err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := client.Call(context.Background(), "rpc", poolamqp.RPCRequest{Body: []byte("hello")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(response.Body) != "echo hello" {
+		t.Fatalf("unexpected response %s", response.Body)
+	}
+
+	_, err = client.Call(context.Background(), "missing", poolamqp.RPCRequest{})
+	if err == nil {
+		t.Fatal("call to missing queue succeeded")
+	}
+}
+
+func TestRPCWithoutSerializerSkipsUserDescriptor(t *testing.T) {
+	broker := amqptest.NewBroker()
+	topology := poolamqp.NewTopologyChannel(poolamqp.Topology{
+		Queues: []poolamqp.Queue{{Name: "rpc"}},
+	})
+	server := poolamqp.NewRPCServer(poolamqp.RPCServerConfig{Queue: "rpc"}, func(ctx context.Context, request poolamqp.RPCRequest) (poolamqp.RPCResponse, error) {
+		if _, ok := auth.UserDescriptorFromContext(ctx); ok {
+			return poolamqp.RPCResponse{Body: []byte("descriptor")}, nil
+		}
+		return poolamqp.RPCResponse{Body: []byte("anonymous")}, nil
+	}, nil, testLogger{t})
+	clientWithSerializer := poolamqp.NewRPCClient(poolamqp.RPCClientConfig{Timeout: testTimeout}, auth.NewUserDescriptorSerializer())
+	clientWithoutSerializer := poolamqp.NewRPCClient(poolamqp.RPCClientConfig{Timeout: testTimeout}, nil)
+
+	if err := broker.ConnectChannels(topology, server, clientWithSerializer, clientWithoutSerializer); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := auth.WithUserDescriptor(context.Background(), auth.UserDescriptor{})
+	for _, client := range []poolamqp.RPCClient{clientWithSerializer, clientWithoutSerializer} {
+		response, err := client.Call(ctx, "rpc", poolamqp.RPCRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(response.Body) != "anonymous" {
+			t.Fatalf("unexpected response %s", response.Body)
+		}
+	}
+}
+
+func TestConfirmPublisherThroughBroker(t *testing.T) {
+	broker := amqptest.NewBroker()
+	topology := poolamqp.NewTopologyChannel(poolamqp.Topology{
+		Queues: []poolamqp.Queue{{Name: "queue"}},
+	})
+	publisher := poolamqp.NewConfirmPublisher(testTimeout)
+	if err := broker.ConnectChannels(topology, publisher); err != nil {
+		t.Fatal(err)
+	}
+
+	err := publisher.PublishBatch([]poolamqp.Message{
+		{RoutingKey: "queue", Mandatory: true},
+		{RoutingKey: "queue"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := broker.MessageCount("queue"); count != 2 {
+		t.Fatalf("expected 2 messages, got %d", count)
+	}
+}
+
+func TestRetrierParksDeliveryAfterAttempts(t *testing.T) {
+	broker := amqptest.NewBroker()
+	topology := poolamqp.NewTopologyChannel(poolamqp.Topology{
+		Queues: []poolamqp.Queue{{Name: "work"}},
+	})
+	retrier := poolamqp.NewRetrier(poolamqp.RetryConfig{
+		Queue:        "work",
+		MaxAttempts:  2,
+		InitialDelay: 10 * time.Millisecond,
+	}, testLogger{t})
+
+	attempts := make(chan int, 3)
+	consumer := poolamqp.NewConsumer(poolamqp.ConsumerConfig{Queue: "work"}, retrier.Handler(func(delivery amqp.Delivery) error {
+		attempts <- poolamqp.RetryCount(delivery)
+		return errors.New("failed")
+	}), testLogger{t})
+
+	if err := broker.ConnectChannels(topology, retrier, consumer); err != nil {
+		t.Fatal(err)
+	}
+	publisher := broker.Channel()
+	if err := publisher.Publish("", "work", false, false, amqp.Publishing{Body: []byte("message")}); err != nil {
+		t.Fatal(err)
+	}
+
+	for expected := 0; expected <= 2; expected++ {
+		select {
+		case retryCount := <-attempts:
+			if retryCount != expected {
+				t.Fatalf("expected retry count %d, got %d", expected, retryCount)
+			}
+		case <-time.After(testTimeout):
+			t.Fatalf("attempt %d is not made", expected)
+		}
+	}
+
+	deadline := time.Now().Add(testTimeout)
+	for broker.MessageCount("work.parking") != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("delivery is not parked")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+type testEvent struct {
+	Value string `json:"value"`
+}
+
+func (e *testEvent) ID() eventbus.EventID {
+	return "test_event"
+}
+
+func TestEventBusDeliversEventsToOtherInstances(t *testing.T) {
+	broker := amqptest.NewBroker()
+	codec := poolamqp.NewJSONEventCodec()
+	codec.Register("test_event", func() eventbus.Event {
+		return &testEvent{}
+	})
+
+	publisher := poolamqp.NewEventBus("events", codec, testLogger{t})
+	subscriber := poolamqp.NewEventBus("events", codec, testLogger{t})
+	if err := broker.ConnectChannels(publisher, subscriber); err != nil {
+		t.Fatal(err)
+	}
+
+	published := make(chan string, 2)
+	received := make(chan string, 2)
+	publisher.Subscribe("test_event", 0, func(event eventbus.Event) {
+		published <- event.(*testEvent).Value
+	})
+	subscriber.Subscribe("test_event", 0, func(event eventbus.Event) {
+		received <- event.(*testEvent).Value
+	})
+
+	publisher.Publish(&testEvent{Value: "value"})
+
+	for name, events := range map[string]chan string{"publisher": published, "subscriber": received} {
+		select {
+		case value := <-events:
+			if value != "value" {
+				t.Fatalf("%s received unexpected value %s", name, value)
+			}
+		case <-time.After(testTimeout):
+			t.Fatalf("%s did not receive event", name)
+		}
+	}
+
+	select {
+	case <-published:
+		t.Fatal("publisher received own event from broker")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+type testLogger struct {
+	t *testing.T
+}
+
+func (l testLogger) Info(args ...interface{}) {
+	l.t.Log(args...)
+}
+
+func (l testLogger) Error(err error, args ...interface{}) {
+	l.t.Log(append([]interface{}{err}, args...)...)
+}
@@ -0,0 +1,102 @@
+package amqptest
+
+import (
+	"sync"
+
+	"github.com/streadway/amqp"
+)
+
+// notifier sends returns and confirmations to listeners one by one in publish order without holding broker lock,
+// so like with amqp.Channel slow listener blocks further notifications of its channel
+type notifier struct {
+	lock     sync.Mutex
+	cond     *sync.Cond
+	pending  []interface{}
+	closed   bool
+	confirms []chan amqp.Confirmation
+	returns  []chan amqp.Return
+}
+
+func newNotifier() *notifier {
+	n := &notifier{}
+	n.cond = sync.NewCond(&n.lock)
+	return n
+}
+
+func (n *notifier) addConfirmListener(listener chan amqp.Confirmation) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.closed {
+		close(listener)
+		return
+	}
+	n.confirms = append(n.confirms, listener)
+}
+
+func (n *notifier) addReturnListener(listener chan amqp.Return) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	if n.closed {
+		close(listener)
+		return
+	}
+	n.returns = append(n.returns, listener)
+}
+
+// push accepts amqp.Return or amqp.Confirmation
+func (n *notifier) push(notification interface{}) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.pending = append(n.pending, notification)
+	n.cond.Broadcast()
+}
+
+// close closes listeners after pending notifications are sent
+func (n *notifier) close() {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	n.closed = true
+	n.cond.Broadcast()
+}
+
+func (n *notifier) run() {
+	for {
+		n.lock.Lock()
+		for len(n.pending) == 0 && !n.closed {
+			n.cond.Wait()
+		}
+		if len(n.pending) == 0 {
+			confirms, returns := n.confirms, n.returns
+			n.confirms, n.returns = nil, nil
+			n.lock.Unlock()
+
+			for _, listener := range confirms {
+				close(listener)
+			}
+			for _, listener := range returns {
+				close(listener)
+			}
+			return
+		}
+
+		notification := n.pending[0]
+		n.pending = n.pending[1:]
+		confirms, returns := n.confirms, n.returns
+		n.lock.Unlock()
+
+		switch value := notification.(type) {
+		case amqp.Confirmation:
+			for _, listener := range confirms {
+				listener <- value
+			}
+		case amqp.Return:
+			for _, listener := range returns {
+				listener <- value
+			}
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package amqp
+
+import "github.com/streadway/amqp"
+
+// BrokerChannel is part of *amqp.Channel used by channels of this package, amqptest.Broker implements it in memory
+type BrokerChannel interface {
+	ExchangeDeclare(name, kind string, durable, autoDelete, internal, noWait bool, args amqp.Table) error
+	QueueDeclare(name string, durable, autoDelete, exclusive, noWait bool, args amqp.Table) (amqp.Queue, error)
+	QueueBind(name, key, exchange string, noWait bool, args amqp.Table) error
+	Qos(prefetchCount, prefetchSize int, global bool) error
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp.Publishing) error
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp.Table) (<-chan amqp.Delivery, error)
+	Cancel(consumer string, noWait bool) error
+	Confirm(noWait bool) error
+	NotifyPublish(confirm chan amqp.Confirmation) chan amqp.Confirmation
+	NotifyReturn(c chan amqp.Return) chan amqp.Return
+	Close() error
+}
+
+var _ BrokerChannel = (*amqp.Channel)(nil)
+
+// ChannelConnector is Channel that can be connected to already opened BrokerChannel
+type ChannelConnector interface {
+	ConnectChannel(channel BrokerChannel) error
+}
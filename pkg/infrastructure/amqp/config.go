@@ -0,0 +1,82 @@
+package amqp
+
+import (
+	stderrors "errors"
+	"net/url"
+	"time"
+
+	"github.com/CuriosityMusicStreaming/ComponentsPool/pkg/infrastructure/tlsconfig"
+	"github.com/pkg/errors"
+	"github.com/streadway/amqp"
+)
+
+const (
+	schemeAMQP       = "amqp"
+	schemeAMQPS      = "amqps"
+	defaultHeartbeat = 10 * time.Second
+)
+
+var ErrTLSWithoutAMQPS = stderrors.New("tls config requires amqps uri")
+
+type TLSConfig = tlsconfig.Config
+
+func (cfg *Config) url() (string, error) {
+	if cfg.URI != "" {
+		uri, err := amqp.ParseURI(cfg.URI)
+		if err != nil {
+			return "", errors.Wrap(err, "invalid amqp uri")
+		}
+		// streadway uses tls config only for amqps, so it would be ignored silently
+		if cfg.TLS != nil && uri.Scheme != schemeAMQPS {
+			return "", errors.WithStack(ErrTLSWithoutAMQPS)
+		}
+		return uri.String(), nil
+	}
+
+	scheme := schemeAMQP
+	if cfg.TLS != nil {
+		scheme = schemeAMQPS
+	}
+
+	u := url.URL{
+		Scheme: scheme,
+		User:   url.UserPassword(cfg.User, cfg.Password),
+		Host:   cfg.Host,
+		Path:   "/",
+	}
+	if cfg.VHost != "" && cfg.VHost != "/" {
+		u.Path = "/" + cfg.VHost
+		u.RawPath = "/" + url.PathEscape(cfg.VHost)
+	}
+	return u.String(), nil
+}
+
+func (cfg *Config) dialConfig() (amqp.Config, error) {
+	heartbeat := cfg.Heartbeat
+	if heartbeat == 0 {
+		heartbeat = defaultHeartbeat
+	}
+
+	dialConfig := amqp.Config{
+		Heartbeat:  heartbeat,
+		ChannelMax: cfg.ChannelMax,
+		Locale:     "en_US",
+	}
+
+	if cfg.ConnectionName != "" {
+		dialConfig.Properties = amqp.Table{
+			"product":         "ComponentsPool",
+			"connection_name": cfg.ConnectionName,
+		}
+	}
+
+	if cfg.TLS != nil {
+		tlsConfig, err := cfg.TLS.Load()
+		if err != nil {
+			return amqp.Config{}, err
+		}
+		dialConfig.TLSClientConfig = tlsConfig
+	}
+
+	return dialConfig, nil
+}
@@ -1,8 +1,10 @@
 package amqp
 
 import (
+	"context"
 	stderrors "errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/cenkalti/backoff"
@@ -10,11 +12,29 @@ import (
 	"github.com/streadway/amqp"
 )
 
+const (
+	defaultReconnectAttempts = 5
+	defaultStopTimeout       = 30 * time.Second
+	reconnectDelay           = time.Second
+)
+
 type Config struct {
-	User           string
-	Password       string
-	Host           string
+	// URI is full amqp:// or amqps:// URI, when set User, Password, Host and VHost are ignored
+	URI      string
+	User     string
+	Password string
+	Host     string
+	VHost    string
+	// TLS enables amqps scheme, URI must have amqps scheme when TLS is set
+	TLS            *TLSConfig
+	Heartbeat      time.Duration
+	ChannelMax     int
+	ConnectionName string
 	ConnectTimeout time.Duration
+	// ReconnectAttempts is number of connect attempts after connection loss, each attempt lasts up to ConnectTimeout
+	ReconnectAttempts int
+	// StopTimeout limits waiting for in-flight deliveries on Stop
+	StopTimeout time.Duration
 }
 
 type Logger interface {
@@ -22,10 +42,47 @@ type Logger interface {
 	Error(error, ...interface{})
 }
 
+type State int
+
+const (
+	StateDisconnected State = iota
+	StateConnecting
+	StateConnected
+	StateReconnecting
+	StateFailed
+	StateStopped
+)
+
+func (s State) String() string {
+	switch s {
+	case StateDisconnected:
+		return "disconnected"
+	case StateConnecting:
+		return "connecting"
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	case StateFailed:
+		return "failed"
+	case StateStopped:
+		return "stopped"
+	default:
+		return fmt.Sprintf("unknown(%d)", int(s))
+	}
+}
+
+type StateListener func(state State)
+
 type Connection interface {
 	Start() error
 	Stop() error
 	AddChannel(channel Channel)
+	State() State
+	// AddStateListener adds listener called on every state transition
+	AddStateListener(listener StateListener)
+	// WaitConnected blocks until connection is established, it fails when connection is failed or stopped
+	WaitConnected(ctx context.Context) error
 }
 
 type Channel interface {
@@ -33,56 +90,197 @@ type Channel interface {
 }
 
 func NewAMQPConnection(cfg *Config, logger Logger) Connection {
-	return &connection{cfg: cfg, logger: logger}
+	stopCtx, stop := context.WithCancel(context.Background())
+	return &connection{
+		cfg:          cfg,
+		logger:       logger,
+		state:        StateDisconnected,
+		stateChanged: make(chan struct{}),
+		stopCtx:      stopCtx,
+		stop:         stop,
+	}
 }
 
 var (
+	ErrConnectionStopped    = stderrors.New("amqp connection is stopped")
+	ErrConnectionFailed     = stderrors.New("amqp connection is failed")
 	errNilAMQPConnection    = stderrors.New("amqp connection is empty")
 	errClosedAMQPConnection = stderrors.New("amqp connection is closed")
 )
 
 type connection struct {
-	cfg      *Config
-	amqpConn *amqp.Connection
-	logger   Logger
-	channels []Channel
+	cfg    *Config
+	logger Logger
+
+	lock         sync.Mutex
+	amqpConn     *amqp.Connection
+	channels     []Channel
+	state        State
+	stateChanged chan struct{}
+
+	listenersLock sync.Mutex
+	listeners     []StateListener
+
+	stopCtx context.Context
+	stop    context.CancelFunc
 }
 
 func (c *connection) Start() error {
-	url := fmt.Sprintf("amqp://%s:%s@%s/", c.cfg.User, c.cfg.Password, c.cfg.Host)
+	if !c.setState(StateConnecting) {
+		return errors.WithStack(ErrConnectionStopped)
+	}
 
-	err := backoff.Retry(func() error {
-		connection, cErr := amqp.Dial(url)
-		c.amqpConn = connection
-		return errors.Wrap(cErr, "failed to connect to amqp")
-	}, newBackOff(c.cfg.ConnectTimeout))
+	err := c.connect()
+	if err != nil {
+		c.setState(StateFailed)
+		return err
+	}
+	return nil
+}
+
+func (c *connection) Stop() error {
+	c.lock.Lock()
+	if c.state == StateStopped {
+		c.lock.Unlock()
+		return nil
+	}
+	conn := c.amqpConn
+	channels := make([]Channel, len(c.channels))
+	copy(channels, c.channels)
+	c.changeState(StateStopped)
+	c.lock.Unlock()
+
+	c.stop()
+	c.notifyListeners(StateStopped)
+
+	if conn == nil || conn.IsClosed() {
+		return nil
+	}
+
+	err := c.drainChannels(channels)
+
+	closeErr := conn.Close()
+	if err == nil && closeErr != nil {
+		err = errors.Wrap(closeErr, "failed to close amqp connection")
+	}
+	return err
+}
+
+func (c *connection) AddChannel(channel Channel) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.channels = append(c.channels, channel)
+}
+
+func (c *connection) State() State {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.state
+}
+
+func (c *connection) AddStateListener(listener StateListener) {
+	c.listenersLock.Lock()
+	defer c.listenersLock.Unlock()
+	c.listeners = append(c.listeners, listener)
+}
+
+func (c *connection) WaitConnected(ctx context.Context) error {
+	for {
+		c.lock.Lock()
+		state, stateChanged := c.state, c.stateChanged
+		c.lock.Unlock()
+
+		switch state {
+		case StateConnected:
+			return nil
+		case StateFailed:
+			return errors.WithStack(ErrConnectionFailed)
+		case StateStopped:
+			return errors.WithStack(ErrConnectionStopped)
+		}
+
+		select {
+		case <-stateChanged:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
 
+func (c *connection) connect() error {
+	url, err := c.cfg.url()
+	if err != nil {
+		return err
+	}
+	dialConfig, err := c.cfg.dialConfig()
+	if err != nil {
+		return err
+	}
+
+	var conn *amqp.Connection
+	err = backoff.Retry(func() error {
+		var cErr error
+		conn, cErr = amqp.DialConfig(url, dialConfig)
+		return errors.Wrap(cErr, "failed to connect to amqp")
+	}, backoff.WithContext(newBackOff(c.cfg.ConnectTimeout), c.stopCtx))
 	if err != nil {
 		return err
 	}
 
-	if err = c.validateConnection(c.amqpConn); err != nil {
+	if err = c.validateConnection(conn); err != nil {
 		return err
 	}
 
-	for _, channel := range c.channels {
-		if err = channel.Connect(c.amqpConn); err != nil {
+	c.lock.Lock()
+	if c.state == StateStopped {
+		c.lock.Unlock()
+		_ = conn.Close()
+		return errors.WithStack(ErrConnectionStopped)
+	}
+	c.amqpConn = conn
+	channels := make([]Channel, len(c.channels))
+	copy(channels, c.channels)
+	c.lock.Unlock()
+
+	for _, channel := range channels {
+		if err = channel.Connect(conn); err != nil {
+			_ = conn.Close()
 			return err
 		}
 	}
 
-	connErrorChan := c.amqpConn.NotifyClose(make(chan *amqp.Error))
+	if !c.setState(StateConnected) {
+		_ = conn.Close()
+		return errors.WithStack(ErrConnectionStopped)
+	}
+
+	connErrorChan := conn.NotifyClose(make(chan *amqp.Error, 1))
 	go c.processConnectErrors(connErrorChan)
 
 	return nil
 }
 
-func (c *connection) Stop() error {
-	return c.amqpConn.Close()
-}
+// drainChannels lets consumers finish in-flight deliveries while connection is still open
+func (c *connection) drainChannels(channels []Channel) error {
+	timeout := c.cfg.StopTimeout
+	if timeout == 0 {
+		timeout = defaultStopTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-func (c *connection) AddChannel(channel Channel) {
-	c.channels = append(c.channels, channel)
+	var err error
+	for _, channel := range channels {
+		drainable, ok := channel.(DrainableChannel)
+		if !ok {
+			continue
+		}
+		drainErr := drainable.Drain(ctx)
+		if err == nil && drainErr != nil {
+			err = drainErr
+		}
+	}
+	return err
 }
 
 func (c *connection) validateConnection(conn *amqp.Connection) error {
@@ -97,19 +295,69 @@ func (c *connection) validateConnection(conn *amqp.Connection) error {
 
 func (c *connection) processConnectErrors(ch chan *amqp.Error) {
 	err := <-ch
+	// nil error means connection is closed intentionally
 	if err == nil {
 		return
 	}
 
+	if !c.setState(StateReconnecting) {
+		return
+	}
 	c.logger.Error(err, "AMQP connection error, trying to reconnect")
-	for {
-		err := c.Start()
-		if err == nil {
+
+	attempts := c.cfg.ReconnectAttempts
+	if attempts == 0 {
+		attempts = defaultReconnectAttempts
+	}
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		connectErr := c.connect()
+		if connectErr == nil {
 			c.logger.Info("AMQP connection restored")
-			break
-		} else {
-			c.logger.Error(err, "failed to reconnect to AMQP")
+			return
+		}
+		if stderrors.Is(connectErr, ErrConnectionStopped) || c.stopCtx.Err() != nil {
+			return
 		}
+		c.logger.Error(connectErr, fmt.Sprintf("failed to reconnect to AMQP, attempt %d of %d", attempt, attempts))
+
+		select {
+		case <-time.After(reconnectDelay):
+		case <-c.stopCtx.Done():
+			return
+		}
+	}
+
+	if c.setState(StateFailed) {
+		c.logger.Error(errors.WithStack(ErrConnectionFailed), "AMQP reconnect attempts are exhausted")
+	}
+}
+
+// setState returns false when connection is already stopped
+func (c *connection) setState(state State) bool {
+	c.lock.Lock()
+	if c.state == StateStopped {
+		c.lock.Unlock()
+		return false
+	}
+	c.changeState(state)
+	c.lock.Unlock()
+
+	c.notifyListeners(state)
+	return true
+}
+
+func (c *connection) changeState(state State) {
+	c.state = state
+	close(c.stateChanged)
+	c.stateChanged = make(chan struct{})
+}
+
+func (c *connection) notifyListeners(state State) {
+	c.listenersLock.Lock()
+	defer c.listenersLock.Unlock()
+	for _, listener := range c.listeners {
+		listener(state)
 	}
 }
 
@@ -0,0 +1,132 @@
+package amqp
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/streadway/amqp"
+)
+
+type DeliveryHandler func(delivery amqp.Delivery) error
+
+// DrainableChannel is stopped by Connection before connection is closed
+type DrainableChannel interface {
+	Channel
+	// Drain stops receiving new deliveries and waits until received deliveries are handled
+	Drain(ctx context.Context) error
+}
+
+type ConsumerConfig struct {
+	Queue         string
+	ConsumerTag   string
+	PrefetchCount int
+	Exclusive     bool
+}
+
+type Consumer interface {
+	DrainableChannel
+	ChannelConnector
+}
+
+// NewConsumer handles deliveries from queue, delivery is acked when handler succeeds and requeued otherwise
+func NewConsumer(cfg ConsumerConfig, handler DeliveryHandler, logger Logger) Consumer {
+	return &consumer{
+		cfg:     cfg,
+		handler: handler,
+		logger:  logger,
+	}
+}
+
+type consumer struct {
+	cfg     ConsumerConfig
+	handler DeliveryHandler
+	logger  Logger
+
+	lock    sync.Mutex
+	channel BrokerChannel
+	tag     string
+	done    chan struct{}
+}
+
+func (c *consumer) Connect(conn *amqp.Connection) error {
+	channel, err := conn.Channel()
+	if err != nil {
+		return errors.Wrap(err, "failed to open channel")
+	}
+	return c.ConnectChannel(channel)
+}
+
+func (c *consumer) ConnectChannel(channel BrokerChannel) error {
+	if c.cfg.PrefetchCount > 0 {
+		err := channel.Qos(c.cfg.PrefetchCount, 0, false)
+		if err != nil {
+			return errors.Wrap(err, "failed to set prefetch count")
+		}
+	}
+
+	tag := c.cfg.ConsumerTag
+	if tag == "" {
+		tag = "ctag-" + uuid.New().String()
+	}
+
+	deliveries, err := channel.Consume(c.cfg.Queue, tag, false, c.cfg.Exclusive, false, false, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to consume queue %s", c.cfg.Queue)
+	}
+
+	done := make(chan struct{})
+
+	c.lock.Lock()
+	c.channel = channel
+	c.tag = tag
+	c.done = done
+	c.lock.Unlock()
+
+	go c.processDeliveries(deliveries, done)
+
+	return nil
+}
+
+func (c *consumer) Drain(ctx context.Context) error {
+	c.lock.Lock()
+	channel, tag, done := c.channel, c.tag, c.done
+	c.channel = nil
+	c.lock.Unlock()
+
+	if channel == nil {
+		return nil
+	}
+
+	err := channel.Cancel(tag, false)
+	if err != nil {
+		return errors.Wrapf(err, "failed to cancel consumer %s", tag)
+	}
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		_ = channel.Close()
+		return errors.Wrapf(ctx.Err(), "failed to drain consumer %s", tag)
+	}
+
+	return errors.Wrap(channel.Close(), "failed to close channel")
+}
+
+func (c *consumer) processDeliveries(deliveries <-chan amqp.Delivery, done chan struct{}) {
+	defer close(done)
+
+	for delivery := range deliveries {
+		var err error
+		if handlerErr := c.handler(delivery); handlerErr != nil {
+			c.logger.Error(handlerErr, "failed to handle delivery from ", c.cfg.Queue)
+			err = delivery.Nack(false, true)
+		} else {
+			err = delivery.Ack(false)
+		}
+		if err != nil {
+			c.logger.Error(err, "failed to acknowledge delivery from ", c.cfg.Queue)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package amqp
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/CuriosityMusicStreaming/ComponentsPool/pkg/infrastructure/mysql"
+	"github.com/CuriosityMusicStreaming/ComponentsPool/pkg/infrastructure/server"
+	"github.com/pkg/errors"
+	"github.com/streadway/amqp"
+)
+
+const (
+	defaultProcessedMessageTable = "processed_message"
+	defaultDeduplicationTTL      = 7 * 24 * time.Hour
+	defaultCleanupInterval       = time.Hour
+	cleanupBatchSize             = 1000
+)
+
+type TransactionalDeliveryHandler func(tx mysql.Transaction, delivery amqp.Delivery) error
+
+type DeduplicatorConfig struct {
+	// Consumer separates processed messages of different consumers of the same message
+	Consumer string
+	// Table is processed_message by default
+	Table string
+	// Retention is how long processed message ids are kept
+	Retention       time.Duration
+	CleanupInterval time.Duration
+}
+
+// Deduplicator skips deliveries which message id is already processed, Serve periodically removes expired ids.
+// Table with default name is created by migrations of mysql.NewLibraryMigrationProvider.
+// Deliveries without message id can't be deduplicated, they are handled at least once as without Deduplicator
+type Deduplicator interface {
+	server.Server
+	Handler(handler TransactionalDeliveryHandler) DeliveryHandler
+	DeleteExpired() (int64, error)
+}
+
+func NewDeduplicator(client mysql.TransactionalClient, cfg DeduplicatorConfig, logger Logger) Deduplicator {
+	if cfg.Table == "" {
+		cfg.Table = defaultProcessedMessageTable
+	}
+	if cfg.Retention == 0 {
+		cfg.Retention = defaultDeduplicationTTL
+	}
+	if cfg.CleanupInterval == 0 {
+		cfg.CleanupInterval = defaultCleanupInterval
+	}
+	return &deduplicator{
+		client:   client,
+		cfg:      cfg,
+		logger:   logger,
+		stopChan: make(chan struct{}),
+	}
+}
+
+type deduplicator struct {
+	client   mysql.TransactionalClient
+	cfg      DeduplicatorConfig
+	logger   Logger
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+// Handler runs handler in transaction which also records message id, so handler changes and record are committed together
+func (d *deduplicator) Handler(handler TransactionalDeliveryHandler) DeliveryHandler {
+	return func(delivery amqp.Delivery) (err error) {
+		tx, err := d.client.BeginTransaction()
+		if err != nil {
+			return errors.Wrap(err, "failed to begin transaction")
+		}
+		defer func() {
+			if err != nil {
+				_ = tx.Rollback()
+			}
+		}()
+
+		if delivery.MessageId != "" {
+			var recorded bool
+			recorded, err = d.record(tx, delivery.MessageId)
+			if err != nil {
+				return err
+			}
+			if !recorded {
+				return errors.WithStack(tx.Rollback())
+			}
+		}
+
+		err = handler(tx, delivery)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Commit()
+		return errors.Wrap(err, "failed to commit transaction")
+	}
+}
+
+// record returns false when message id is already processed
+func (d *deduplicator) record(tx mysql.Transaction, messageID string) (bool, error) {
+	//nolint:gosec
+	query := fmt.Sprintf(`INSERT IGNORE INTO %s (consumer, message_id, processed_at) VALUES (?, ?, UTC_TIMESTAMP())`, d.cfg.Table)
+	result, err := tx.Exec(query, d.cfg.Consumer, messageID)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to record processed message")
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	return inserted != 0, nil
+}
+
+func (d *deduplicator) DeleteExpired() (int64, error) {
+	//nolint:gosec
+	query := fmt.Sprintf(`DELETE FROM %s WHERE processed_at < ? LIMIT %d`, d.cfg.Table, cleanupBatchSize)
+	expiredBefore := time.Now().UTC().Add(-d.cfg.Retention)
+
+	var total int64
+	for {
+		result, err := d.client.Exec(query, expiredBefore)
+		if err != nil {
+			return total, errors.Wrap(err, "failed to delete expired processed messages")
+		}
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			return total, errors.WithStack(err)
+		}
+		total += deleted
+		if deleted < cleanupBatchSize {
+			return total, nil
+		}
+	}
+}
+
+func (d *deduplicator) Serve() error {
+	ticker := time.NewTicker(d.cfg.CleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := d.DeleteExpired(); err != nil {
+				d.logger.Error(err, "failed to cleanup processed messages")
+			}
+		case <-d.stopChan:
+			return nil
+		}
+	}
+}
+
+func (d *deduplicator) Stop() error {
+	d.stopOnce.Do(func() {
+		close(d.stopChan)
+	})
+	return nil
+}
@@ -0,0 +1,199 @@
+package amqp
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"sync"
+
+	"github.com/CuriosityMusicStreaming/ComponentsPool/pkg/app/eventbus"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/streadway/amqp"
+)
+
+var (
+	ErrBusNotConnected   = stderrors.New("amqp event bus is not connected")
+	ErrUnknownEventID    = stderrors.New("unknown event id")
+	errUnexpectedEventID = stderrors.New("event id does not match registered type")
+)
+
+type EventCodec interface {
+	Encode(event eventbus.Event) ([]byte, error)
+	Decode(eventID eventbus.EventID, body []byte) (eventbus.Event, error)
+}
+
+// EventBus is eventbus.Bus that also delivers events to other instances subscribed to the same exchange
+type EventBus interface {
+	eventbus.InspectableBus
+	Channel
+	ChannelConnector
+}
+
+func NewEventBus(exchangeName string, codec EventCodec, logger Logger) EventBus {
+	return &eventBus{
+		local:        eventbus.NewBus(),
+		exchangeName: exchangeName,
+		instanceID:   uuid.New().String(),
+		codec:        codec,
+		logger:       logger,
+	}
+}
+
+type eventBus struct {
+	local        eventbus.InspectableBus
+	exchangeName string
+	instanceID   string
+	codec        EventCodec
+	logger       Logger
+
+	lock    sync.Mutex
+	channel BrokerChannel
+}
+
+func (b *eventBus) Subscribe(eventID eventbus.EventID, priority int, handler eventbus.EventHandler) eventbus.Subscription {
+	return b.local.Subscribe(eventID, priority, handler)
+}
+
+func (b *eventBus) Unsubscribe(subscription eventbus.Subscription) {
+	b.local.Unsubscribe(subscription)
+}
+
+func (b *eventBus) Subscriptions() []eventbus.EventSubscriptions {
+	return b.local.Subscriptions()
+}
+
+func (b *eventBus) Stats() []eventbus.EventStats {
+	return b.local.Stats()
+}
+
+func (b *eventBus) Publish(event eventbus.Event) {
+	b.local.Publish(event)
+
+	if err := b.publishRemote(event); err != nil {
+		b.logger.Error(err, "failed to publish event to amqp event bus")
+	}
+}
+
+func (b *eventBus) Connect(conn *amqp.Connection) error {
+	channel, err := conn.Channel()
+	if err != nil {
+		return errors.Wrap(err, "failed to open channel")
+	}
+	return b.ConnectChannel(channel)
+}
+
+func (b *eventBus) ConnectChannel(channel BrokerChannel) error {
+	err := channel.ExchangeDeclare(b.exchangeName, amqp.ExchangeFanout, true, false, false, false, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to declare exchange %s", b.exchangeName)
+	}
+
+	queue, err := channel.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to declare queue")
+	}
+
+	err = channel.QueueBind(queue.Name, "", b.exchangeName, false, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to bind queue %s", queue.Name)
+	}
+
+	deliveries, err := channel.Consume(queue.Name, "", true, true, false, false, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to consume queue %s", queue.Name)
+	}
+
+	b.lock.Lock()
+	b.channel = channel
+	b.lock.Unlock()
+
+	go b.processDeliveries(deliveries)
+
+	return nil
+}
+
+func (b *eventBus) publishRemote(event eventbus.Event) error {
+	body, err := b.codec.Encode(event)
+	if err != nil {
+		return errors.Wrapf(err, "failed to encode event %s", event.ID())
+	}
+
+	b.lock.Lock()
+	channel := b.channel
+	b.lock.Unlock()
+
+	if channel == nil {
+		return errors.WithStack(ErrBusNotConnected)
+	}
+
+	err = channel.Publish(b.exchangeName, "", false, false, amqp.Publishing{
+		Type:  string(event.ID()),
+		AppId: b.instanceID,
+		Body:  body,
+	})
+	return errors.Wrapf(err, "failed to publish event %s", event.ID())
+}
+
+func (b *eventBus) processDeliveries(deliveries <-chan amqp.Delivery) {
+	for delivery := range deliveries {
+		if delivery.AppId == b.instanceID {
+			continue
+		}
+
+		event, err := b.codec.Decode(eventbus.EventID(delivery.Type), delivery.Body)
+		if err != nil {
+			b.logger.Error(err, "failed to decode event from amqp event bus")
+			continue
+		}
+
+		b.local.Publish(event)
+	}
+}
+
+type EventFactory func() eventbus.Event
+
+// JSONEventCodec encodes events as JSON, events are decoded into values created by registered factories
+type JSONEventCodec interface {
+	EventCodec
+	Register(eventID eventbus.EventID, factory EventFactory)
+}
+
+func NewJSONEventCodec() JSONEventCodec {
+	return &jsonEventCodec{
+		factories: make(map[eventbus.EventID]EventFactory),
+	}
+}
+
+type jsonEventCodec struct {
+	lock      sync.RWMutex
+	factories map[eventbus.EventID]EventFactory
+}
+
+func (c *jsonEventCodec) Register(eventID eventbus.EventID, factory EventFactory) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.factories[eventID] = factory
+}
+
+func (c *jsonEventCodec) Encode(event eventbus.Event) ([]byte, error) {
+	body, err := json.Marshal(event)
+	return body, errors.WithStack(err)
+}
+
+func (c *jsonEventCodec) Decode(eventID eventbus.EventID, body []byte) (eventbus.Event, error) {
+	c.lock.RLock()
+	factory, ok := c.factories[eventID]
+	c.lock.RUnlock()
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownEventID, "event %s", eventID)
+	}
+
+	event := factory()
+	if err := json.Unmarshal(body, event); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if event.ID() != eventID {
+		return nil, errors.Wrapf(errUnexpectedEventID, "expected %s, got %s", eventID, event.ID())
+	}
+	return event, nil
+}
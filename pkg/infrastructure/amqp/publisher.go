@@ -0,0 +1,252 @@
+package amqp
+
+import (
+	stderrors "errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/streadway/amqp"
+)
+
+const defaultConfirmTimeout = 10 * time.Second
+
+var (
+	ErrPublisherNotConnected = stderrors.New("amqp publisher is not connected")
+	ErrPublishNacked         = stderrors.New("message is nacked by broker")
+	ErrPublishTimeout        = stderrors.New("timeout is reached for publish confirmation")
+	ErrMessageReturned       = stderrors.New("message is returned by broker")
+	errConfirmsClosed        = stderrors.New("amqp channel is closed while waiting for confirmation")
+)
+
+type Message struct {
+	Exchange   string
+	RoutingKey string
+	// Mandatory messages that can't be routed to any queue are reported as ErrMessageReturned
+	Mandatory  bool
+	Publishing amqp.Publishing
+}
+
+// ConfirmPublisher publishes messages in confirm mode and waits until broker acknowledges them
+type ConfirmPublisher interface {
+	Channel
+	ChannelConnector
+	Publish(msg Message) error
+	PublishBatch(msgs []Message) error
+}
+
+func NewConfirmPublisher(confirmTimeout time.Duration) ConfirmPublisher {
+	if confirmTimeout == 0 {
+		confirmTimeout = defaultConfirmTimeout
+	}
+	return &confirmPublisher{confirmTimeout: confirmTimeout}
+}
+
+type pendingConfirm struct {
+	messageID string
+	result    chan error
+}
+
+type confirmPublisher struct {
+	confirmTimeout time.Duration
+
+	publishLock sync.Mutex
+	channel     BrokerChannel
+	// nextTag is delivery tag of next published message
+	nextTag uint64
+
+	lock     sync.Mutex
+	pending  map[uint64]*pendingConfirm
+	returned map[string]amqp.Return
+}
+
+func (p *confirmPublisher) Connect(conn *amqp.Connection) error {
+	channel, err := conn.Channel()
+	if err != nil {
+		return errors.Wrap(err, "failed to open channel")
+	}
+	return p.ConnectChannel(channel)
+}
+
+func (p *confirmPublisher) ConnectChannel(channel BrokerChannel) error {
+	err := channel.Confirm(false)
+	if err != nil {
+		return errors.Wrap(err, "failed to enable confirm mode")
+	}
+
+	confirms := channel.NotifyPublish(make(chan amqp.Confirmation, 1))
+	// channel sends return and then ack of the same message from one goroutine, unbuffered returns
+	// guarantee that return is recorded before ack is received
+	returns := channel.NotifyReturn(make(chan amqp.Return))
+
+	p.publishLock.Lock()
+	defer p.publishLock.Unlock()
+
+	p.failPending(errConfirmsClosed)
+
+	p.lock.Lock()
+	p.pending = make(map[uint64]*pendingConfirm)
+	p.returned = make(map[string]amqp.Return)
+	p.lock.Unlock()
+
+	p.channel = channel
+	p.nextTag = 1
+
+	go p.processConfirms(channel, confirms, returns)
+
+	return nil
+}
+
+func (p *confirmPublisher) Publish(msg Message) error {
+	return p.PublishBatch([]Message{msg})
+}
+
+func (p *confirmPublisher) PublishBatch(msgs []Message) error {
+	results, err := p.publish(msgs)
+	if err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(p.confirmTimeout)
+	defer timer.Stop()
+
+	for tag, result := range results {
+		select {
+		case confirmErr := <-result:
+			if err == nil {
+				err = confirmErr
+			}
+		case <-timer.C:
+			p.lock.Lock()
+			for pendingTag := range results {
+				if pending, ok := p.pending[pendingTag]; ok {
+					delete(p.returned, pending.messageID)
+					delete(p.pending, pendingTag)
+				}
+			}
+			p.lock.Unlock()
+			return errors.Wrapf(ErrPublishTimeout, "delivery tag %d", tag)
+		}
+	}
+	return err
+}
+
+func (p *confirmPublisher) publish(msgs []Message) (map[uint64]chan error, error) {
+	p.publishLock.Lock()
+	defer p.publishLock.Unlock()
+
+	if p.channel == nil {
+		return nil, errors.WithStack(ErrPublisherNotConnected)
+	}
+
+	results := make(map[uint64]chan error, len(msgs))
+	for _, msg := range msgs {
+		if msg.Mandatory && msg.Publishing.MessageId == "" {
+			msg.Publishing.MessageId = uuid.New().String()
+		}
+
+		pending := &pendingConfirm{
+			messageID: msg.Publishing.MessageId,
+			result:    make(chan error, 1),
+		}
+
+		// register before publish, confirmation may arrive before Publish returns
+		p.lock.Lock()
+		p.pending[p.nextTag] = pending
+		p.lock.Unlock()
+
+		err := p.channel.Publish(msg.Exchange, msg.RoutingKey, msg.Mandatory, false, msg.Publishing)
+		if err != nil {
+			p.lock.Lock()
+			delete(p.pending, p.nextTag)
+			for tag := range results {
+				delete(p.pending, tag)
+			}
+			p.lock.Unlock()
+			return nil, errors.Wrapf(err, "failed to publish message to %s", msg.Exchange)
+		}
+
+		results[p.nextTag] = pending.result
+		p.nextTag++
+	}
+	return results, nil
+}
+
+func (p *confirmPublisher) processConfirms(channel BrokerChannel, confirms <-chan amqp.Confirmation, returns <-chan amqp.Return) {
+	for {
+		select {
+		case confirmation, ok := <-confirms:
+			if !ok {
+				p.publishLock.Lock()
+				if p.channel == channel {
+					p.channel = nil
+					p.failPending(errConfirmsClosed)
+				}
+				p.publishLock.Unlock()
+				return
+			}
+			p.confirm(confirmation)
+		case ret, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			// broker sends return before confirmation of the same message
+			p.lock.Lock()
+			if p.isPendingLocked(ret.MessageId) {
+				p.returned[ret.MessageId] = ret
+			}
+			p.lock.Unlock()
+		}
+	}
+}
+
+func (p *confirmPublisher) confirm(confirmation amqp.Confirmation) {
+	p.lock.Lock()
+	pending, ok := p.pending[confirmation.DeliveryTag]
+	delete(p.pending, confirmation.DeliveryTag)
+	var ret amqp.Return
+	var returned bool
+	if ok && pending.messageID != "" {
+		ret, returned = p.returned[pending.messageID]
+		delete(p.returned, pending.messageID)
+	}
+	p.lock.Unlock()
+
+	if !ok {
+		return
+	}
+
+	var err error
+	switch {
+	case !confirmation.Ack:
+		err = errors.Wrapf(ErrPublishNacked, "delivery tag %d", confirmation.DeliveryTag)
+	case returned:
+		err = errors.Wrapf(ErrMessageReturned, "message %s to %s: %d %s", ret.MessageId, ret.Exchange, ret.ReplyCode, ret.ReplyText)
+	}
+	pending.result <- err
+}
+
+// isPendingLocked is false for returns of messages dropped on timeout, so they are not kept forever
+func (p *confirmPublisher) isPendingLocked(messageID string) bool {
+	for _, pending := range p.pending {
+		if pending.messageID == messageID {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *confirmPublisher) failPending(err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for tag, pending := range p.pending {
+		pending.result <- errors.WithStack(err)
+		delete(p.pending, tag)
+	}
+	for messageID := range p.returned {
+		delete(p.returned, messageID)
+	}
+}
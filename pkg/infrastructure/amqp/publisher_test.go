@@ -0,0 +1,44 @@
+package amqp_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	poolamqp "github.com/CuriosityMusicStreaming/ComponentsPool/pkg/infrastructure/amqp"
+	"github.com/CuriosityMusicStreaming/ComponentsPool/pkg/infrastructure/amqp/amqptest"
+	"github.com/pkg/errors"
+)
+
+// Broker sends return of unroutable mandatory message before its ack, concurrent publishes make publisher
+// receive return and ack of next message while it handles previous ack
+func TestConfirmPublisherReportsReturnSentBeforeAck(t *testing.T) {
+	broker := amqptest.NewBroker()
+	publisher := poolamqp.NewConfirmPublisher(time.Second)
+	if err := broker.ConnectChannels(publisher); err != nil {
+		t.Fatal(err)
+	}
+
+	const publishers = 8
+	const messages = 200
+
+	errs := make(chan error, publishers*messages)
+	var wg sync.WaitGroup
+	for i := 0; i < publishers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < messages; j++ {
+				errs <- publisher.Publish(poolamqp.Message{RoutingKey: "missing", Mandatory: true})
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if errors.Cause(err) != poolamqp.ErrMessageReturned {
+			t.Fatalf("expected ErrMessageReturned, got %v", err)
+		}
+	}
+}
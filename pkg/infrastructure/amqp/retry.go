@@ -0,0 +1,192 @@
+package amqp
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/streadway/amqp"
+)
+
+const (
+	RetryCountHeader = "x-retry-count"
+	LastErrorHeader  = "x-last-error"
+
+	defaultRetryMaxAttempts  = 5
+	defaultRetryInitialDelay = time.Second
+	defaultRetryMultiplier   = 2
+)
+
+type RetryConfig struct {
+	// Queue is consumed queue, failed deliveries are returned to it after delay
+	Queue string
+	// MaxAttempts is number of retries before delivery is moved to parking queue
+	MaxAttempts  int
+	InitialDelay time.Duration
+	Multiplier   float64
+	// MaxDelay is zero when delay is not limited
+	MaxDelay time.Duration
+	// ParkingQueue is Queue with ".parking" suffix by default
+	ParkingQueue string
+}
+
+// Retrier declares wait and parking queues for Queue and republishes failed deliveries into them
+type Retrier interface {
+	Channel
+	ChannelConnector
+	Handler(handler DeliveryHandler) DeliveryHandler
+	Topology() Topology
+}
+
+func NewRetrier(cfg RetryConfig, logger Logger) Retrier {
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if cfg.InitialDelay == 0 {
+		cfg.InitialDelay = defaultRetryInitialDelay
+	}
+	if cfg.Multiplier == 0 {
+		cfg.Multiplier = defaultRetryMultiplier
+	}
+	if cfg.ParkingQueue == "" {
+		cfg.ParkingQueue = cfg.Queue + ".parking"
+	}
+
+	return &retrier{
+		cfg:       cfg,
+		delays:    retryDelays(&cfg),
+		publisher: NewConfirmPublisher(0),
+		logger:    logger,
+	}
+}
+
+type retrier struct {
+	cfg       RetryConfig
+	delays    []time.Duration
+	publisher ConfirmPublisher
+	logger    Logger
+}
+
+func (r *retrier) Connect(conn *amqp.Connection) error {
+	err := NewTopologyChannel(r.Topology()).Connect(conn)
+	if err != nil {
+		return err
+	}
+	return r.publisher.Connect(conn)
+}
+
+func (r *retrier) ConnectChannel(channel BrokerChannel) error {
+	topology := r.Topology()
+	err := DeclareTopology(channel, &topology)
+	if err != nil {
+		return err
+	}
+	return r.publisher.ConnectChannel(channel)
+}
+
+func (r *retrier) Topology() Topology {
+	topology := Topology{
+		Queues: []Queue{{Name: r.cfg.ParkingQueue, Durable: true}},
+	}
+	for _, delay := range r.uniqueDelays() {
+		topology.Queues = append(topology.Queues, Queue{
+			Name:                 r.waitQueueName(delay),
+			Durable:              true,
+			MessageTTL:           delay,
+			DeadLetterExchange:   "",
+			DeadLetterRoutingKey: r.cfg.Queue,
+		})
+	}
+	return topology
+}
+
+// Handler acks failed delivery after it is republished to wait queue, so handler returns error only when republishing fails
+func (r *retrier) Handler(handler DeliveryHandler) DeliveryHandler {
+	return func(delivery amqp.Delivery) error {
+		handlerErr := handler(delivery)
+		if handlerErr == nil {
+			return nil
+		}
+
+		retryCount := RetryCount(delivery) + 1
+		routingKey := r.cfg.ParkingQueue
+		if retryCount <= r.cfg.MaxAttempts {
+			routingKey = r.waitQueueName(r.delays[retryCount-1])
+		} else {
+			r.logger.Error(handlerErr, fmt.Sprintf("delivery from %s is parked after %d attempts", r.cfg.Queue, r.cfg.MaxAttempts))
+		}
+
+		err := r.publisher.Publish(Message{
+			RoutingKey: routingKey,
+			Mandatory:  true,
+			Publishing: retryPublishing(delivery, retryCount, handlerErr),
+		})
+		return errors.Wrapf(err, "failed to republish delivery to %s", routingKey)
+	}
+}
+
+func (r *retrier) waitQueueName(delay time.Duration) string {
+	return fmt.Sprintf("%s.wait.%d", r.cfg.Queue, delay.Milliseconds())
+}
+
+func (r *retrier) uniqueDelays() []time.Duration {
+	var result []time.Duration
+	for i, delay := range r.delays {
+		if i == 0 || delay != r.delays[i-1] {
+			result = append(result, delay)
+		}
+	}
+	return result
+}
+
+// RetryCount returns number of times delivery was already retried
+func RetryCount(delivery amqp.Delivery) int {
+	switch count := delivery.Headers[RetryCountHeader].(type) {
+	case int32:
+		return int(count)
+	case int64:
+		return int(count)
+	case int:
+		return count
+	default:
+		return 0
+	}
+}
+
+func retryDelays(cfg *RetryConfig) []time.Duration {
+	delays := make([]time.Duration, cfg.MaxAttempts)
+	delay := cfg.InitialDelay
+	for i := range delays {
+		if cfg.MaxDelay != 0 && delay > cfg.MaxDelay {
+			delay = cfg.MaxDelay
+		}
+		delays[i] = delay
+		delay = time.Duration(float64(delay) * cfg.Multiplier)
+	}
+	return delays
+}
+
+func retryPublishing(delivery amqp.Delivery, retryCount int, handlerErr error) amqp.Publishing {
+	headers := amqp.Table{}
+	for key, value := range delivery.Headers {
+		headers[key] = value
+	}
+	headers[RetryCountHeader] = int32(retryCount)
+	headers[LastErrorHeader] = handlerErr.Error()
+
+	return amqp.Publishing{
+		Headers:         headers,
+		ContentType:     delivery.ContentType,
+		ContentEncoding: delivery.ContentEncoding,
+		DeliveryMode:    amqp.Persistent,
+		Priority:        delivery.Priority,
+		CorrelationId:   delivery.CorrelationId,
+		ReplyTo:         delivery.ReplyTo,
+		MessageId:       delivery.MessageId,
+		Timestamp:       delivery.Timestamp,
+		Type:            delivery.Type,
+		UserId:          delivery.UserId,
+		AppId:           delivery.AppId,
+		Body:            delivery.Body,
+	}
+}
@@ -0,0 +1,338 @@
+package amqp
+
+import (
+	"context"
+	stderrors "errors"
+	"sync"
+	"time"
+
+	"github.com/CuriosityMusicStreaming/ComponentsPool/pkg/app/auth"
+	"github.com/CuriosityMusicStreaming/ComponentsPool/pkg/infrastructure/activity"
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+	"github.com/streadway/amqp"
+)
+
+const (
+	ActivityIDHeader     = "x-activity-id"
+	UserDescriptorHeader = "x-user-descriptor"
+	RPCErrorHeader       = "x-rpc-error"
+
+	directReplyQueue      = "amq.rabbitmq.reply-to"
+	defaultRPCCallTimeout = 30 * time.Second
+)
+
+var (
+	ErrRPCFailed         = stderrors.New("rpc call failed")
+	ErrRPCUnroutable     = stderrors.New("rpc request is not routed to any queue")
+	ErrRPCNotConnected   = stderrors.New("rpc client is not connected")
+	errRPCChannelClosed  = stderrors.New("rpc channel is closed")
+	errInvalidActivityID = stderrors.New("invalid activity id header")
+)
+
+type RPCRequest struct {
+	Type        string
+	ContentType string
+	Body        []byte
+}
+
+type RPCResponse struct {
+	ContentType string
+	Body        []byte
+}
+
+type RPCHandler func(ctx context.Context, request RPCRequest) (RPCResponse, error)
+
+type RPCClientConfig struct {
+	// Exchange is default exchange when empty, so routing key is name of server queue
+	Exchange string
+	// Timeout is used for calls without context deadline
+	Timeout time.Duration
+}
+
+type RPCClient interface {
+	Channel
+	ChannelConnector
+	Call(ctx context.Context, routingKey string, request RPCRequest) (RPCResponse, error)
+}
+
+// NewRPCClient makes client, serializer is optional: without it user descriptor of ctx isn't passed to server
+func NewRPCClient(cfg RPCClientConfig, serializer auth.UserDescriptorSerializer) RPCClient {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultRPCCallTimeout
+	}
+	return &rpcClient{
+		cfg:        cfg,
+		serializer: serializer,
+		pending:    make(map[string]chan rpcResult),
+	}
+}
+
+type rpcResult struct {
+	response RPCResponse
+	err      error
+}
+
+type rpcClient struct {
+	cfg        RPCClientConfig
+	serializer auth.UserDescriptorSerializer
+
+	lock    sync.Mutex
+	channel BrokerChannel
+	pending map[string]chan rpcResult
+}
+
+func (c *rpcClient) Connect(conn *amqp.Connection) error {
+	channel, err := conn.Channel()
+	if err != nil {
+		return errors.Wrap(err, "failed to open channel")
+	}
+	return c.ConnectChannel(channel)
+}
+
+func (c *rpcClient) ConnectChannel(channel BrokerChannel) error {
+	// direct reply-to requires consuming in no-ack mode before publishing requests
+	deliveries, err := channel.Consume(directReplyQueue, "", true, true, false, false, nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to consume direct reply-to")
+	}
+	returns := channel.NotifyReturn(make(chan amqp.Return, 1))
+
+	c.lock.Lock()
+	c.channel = channel
+	c.lock.Unlock()
+
+	go c.processReplies(channel, deliveries, returns)
+
+	return nil
+}
+
+func (c *rpcClient) Call(ctx context.Context, routingKey string, request RPCRequest) (RPCResponse, error) {
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.cfg.Timeout)
+		defer cancel()
+	}
+
+	headers, err := c.headers(ctx)
+	if err != nil {
+		return RPCResponse{}, err
+	}
+
+	correlationID := uuid.New().String()
+	result := make(chan rpcResult, 1)
+
+	c.lock.Lock()
+	channel := c.channel
+	if channel != nil {
+		c.pending[correlationID] = result
+	}
+	c.lock.Unlock()
+
+	if channel == nil {
+		return RPCResponse{}, errors.WithStack(ErrRPCNotConnected)
+	}
+	defer c.removePending(correlationID)
+
+	err = channel.Publish(c.cfg.Exchange, routingKey, true, false, amqp.Publishing{
+		Headers:       headers,
+		ContentType:   request.ContentType,
+		CorrelationId: correlationID,
+		ReplyTo:       directReplyQueue,
+		Type:          request.Type,
+		Body:          request.Body,
+	})
+	if err != nil {
+		return RPCResponse{}, errors.Wrapf(err, "failed to publish rpc request to %s", routingKey)
+	}
+
+	select {
+	case res := <-result:
+		return res.response, res.err
+	case <-ctx.Done():
+		return RPCResponse{}, errors.Wrapf(ctx.Err(), "rpc call to %s", routingKey)
+	}
+}
+
+func (c *rpcClient) headers(ctx context.Context) (amqp.Table, error) {
+	headers := amqp.Table{}
+	if id, ok := activity.ActivityIDFromContext(ctx); ok {
+		headers[ActivityIDHeader] = id.String()
+	}
+	if descriptor, ok := auth.UserDescriptorFromContext(ctx); ok && c.serializer != nil {
+		serialized, err := c.serializer.Serialize(descriptor)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to serialize user descriptor")
+		}
+		headers[UserDescriptorHeader] = serialized
+	}
+	return headers, nil
+}
+
+func (c *rpcClient) processReplies(channel BrokerChannel, deliveries <-chan amqp.Delivery, returns <-chan amqp.Return) {
+	for deliveries != nil || returns != nil {
+		select {
+		case delivery, ok := <-deliveries:
+			if !ok {
+				deliveries = nil
+				continue
+			}
+			res := rpcResult{response: RPCResponse{ContentType: delivery.ContentType, Body: delivery.Body}}
+			if rpcErr, isErr := delivery.Headers[RPCErrorHeader].(string); isErr {
+				res = rpcResult{err: errors.Wrap(ErrRPCFailed, rpcErr)}
+			}
+			c.resolve(delivery.CorrelationId, res)
+		case ret, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			c.resolve(ret.CorrelationId, rpcResult{err: errors.Wrapf(ErrRPCUnroutable, "%s: %s", ret.RoutingKey, ret.ReplyText)})
+		}
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.channel != channel {
+		return
+	}
+	c.channel = nil
+	for correlationID, result := range c.pending {
+		result <- rpcResult{err: errors.WithStack(errRPCChannelClosed)}
+		delete(c.pending, correlationID)
+	}
+}
+
+func (c *rpcClient) resolve(correlationID string, res rpcResult) {
+	c.lock.Lock()
+	result, ok := c.pending[correlationID]
+	delete(c.pending, correlationID)
+	c.lock.Unlock()
+
+	if ok {
+		result <- res
+	}
+}
+
+func (c *rpcClient) removePending(correlationID string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.pending, correlationID)
+}
+
+type RPCServerConfig struct {
+	Queue         string
+	PrefetchCount int
+}
+
+type RPCServer interface {
+	DrainableChannel
+	ChannelConnector
+}
+
+// NewRPCServer handles requests from queue and replies to reply-to queue of request,
+// serializer is optional: without it user descriptor of request is ignored
+func NewRPCServer(cfg RPCServerConfig, handler RPCHandler, serializer auth.UserDescriptorSerializer, logger Logger) RPCServer {
+	s := &rpcServer{
+		handler:    handler,
+		serializer: serializer,
+	}
+	s.consumer = NewConsumer(ConsumerConfig{
+		Queue:         cfg.Queue,
+		PrefetchCount: cfg.PrefetchCount,
+	}, s.handle, logger)
+	return s
+}
+
+type rpcServer struct {
+	consumer   Consumer
+	handler    RPCHandler
+	serializer auth.UserDescriptorSerializer
+
+	lock    sync.Mutex
+	channel BrokerChannel
+}
+
+func (s *rpcServer) Connect(conn *amqp.Connection) error {
+	channel, err := conn.Channel()
+	if err != nil {
+		return errors.Wrap(err, "failed to open channel")
+	}
+
+	s.lock.Lock()
+	s.channel = channel
+	s.lock.Unlock()
+
+	return s.consumer.Connect(conn)
+}
+
+// ConnectChannel consumes requests and publishes replies on the same channel
+func (s *rpcServer) ConnectChannel(channel BrokerChannel) error {
+	s.lock.Lock()
+	s.channel = channel
+	s.lock.Unlock()
+
+	return s.consumer.ConnectChannel(channel)
+}
+
+func (s *rpcServer) Drain(ctx context.Context) error {
+	return s.consumer.Drain(ctx)
+}
+
+// handle returns error only when reply is not sent, so request is requeued
+func (s *rpcServer) handle(delivery amqp.Delivery) error {
+	ctx, err := s.context(delivery)
+
+	var response RPCResponse
+	if err == nil {
+		response, err = s.handler(ctx, RPCRequest{
+			Type:        delivery.Type,
+			ContentType: delivery.ContentType,
+			Body:        delivery.Body,
+		})
+	}
+
+	if delivery.ReplyTo == "" {
+		return nil
+	}
+
+	reply := amqp.Publishing{
+		ContentType:   response.ContentType,
+		CorrelationId: delivery.CorrelationId,
+		Body:          response.Body,
+	}
+	if err != nil {
+		reply = amqp.Publishing{
+			Headers:       amqp.Table{RPCErrorHeader: err.Error()},
+			CorrelationId: delivery.CorrelationId,
+		}
+	}
+
+	s.lock.Lock()
+	channel := s.channel
+	s.lock.Unlock()
+
+	return errors.Wrap(channel.Publish("", delivery.ReplyTo, false, false, reply), "failed to publish rpc reply")
+}
+
+func (s *rpcServer) context(delivery amqp.Delivery) (context.Context, error) {
+	ctx := context.Background()
+
+	if value, ok := delivery.Headers[ActivityIDHeader].(string); ok {
+		id, err := activity.ParseActivityID(value)
+		if err != nil {
+			return nil, errors.Wrap(errInvalidActivityID, err.Error())
+		}
+		ctx = activity.WithActivityID(ctx, id)
+	}
+
+	if value, ok := delivery.Headers[UserDescriptorHeader].(string); ok && s.serializer != nil {
+		descriptor, err := s.serializer.Deserialize(value)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to deserialize user descriptor")
+		}
+		ctx = auth.WithUserDescriptor(ctx, descriptor)
+	}
+
+	return ctx, nil
+}
@@ -0,0 +1,98 @@
+package amqp
+
+import (
+	stderrors "errors"
+	"sync"
+
+	"github.com/CuriosityMusicStreaming/ComponentsPool/pkg/infrastructure/server"
+	"github.com/pkg/errors"
+)
+
+var ErrConnectionNotReady = stderrors.New("amqp connection is not ready")
+
+type Health struct {
+	State State
+	Ready bool
+}
+
+// ConnectionServer runs Connection inside server.Hub
+type ConnectionServer interface {
+	server.Server
+	Health() Health
+	// Ready returns error when connection is not connected, it is intended for readiness probes
+	Ready() error
+}
+
+func NewConnectionServer(conn Connection) ConnectionServer {
+	s := &connectionServer{
+		conn:     conn,
+		failed:   make(chan struct{}),
+		stopChan: make(chan struct{}),
+	}
+	conn.AddStateListener(func(state State) {
+		if state == StateFailed {
+			s.failOnce.Do(func() {
+				close(s.failed)
+			})
+		}
+	})
+	return s
+}
+
+type connectionServer struct {
+	conn     Connection
+	failed   chan struct{}
+	failOnce sync.Once
+	stopChan chan struct{}
+	stopOnce sync.Once
+}
+
+// Serve blocks until server is stopped or connection is failed after reconnect attempts are exhausted
+func (s *connectionServer) Serve() error {
+	err := s.conn.Start()
+	if err != nil {
+		if s.isStopped() {
+			return nil
+		}
+		return err
+	}
+
+	select {
+	case <-s.failed:
+		return errors.WithStack(ErrConnectionFailed)
+	case <-s.stopChan:
+		return nil
+	}
+}
+
+func (s *connectionServer) Stop() error {
+	s.stopOnce.Do(func() {
+		close(s.stopChan)
+	})
+	return s.conn.Stop()
+}
+
+func (s *connectionServer) Health() Health {
+	state := s.conn.State()
+	return Health{
+		State: state,
+		Ready: state == StateConnected,
+	}
+}
+
+func (s *connectionServer) Ready() error {
+	health := s.Health()
+	if !health.Ready {
+		return errors.Wrapf(ErrConnectionNotReady, "state %s", health.State)
+	}
+	return nil
+}
+
+func (s *connectionServer) isStopped() bool {
+	select {
+	case <-s.stopChan:
+		return true
+	default:
+		return false
+	}
+}
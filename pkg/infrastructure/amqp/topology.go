@@ -0,0 +1,204 @@
+package amqp
+
+import (
+	stderrors "errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/streadway/amqp"
+)
+
+var ErrInvalidTopology = stderrors.New("invalid amqp topology")
+
+const predeclaredExchangePrefix = "amq."
+
+type Exchange struct {
+	Name       string
+	Kind       string
+	Durable    bool
+	AutoDelete bool
+	Internal   bool
+	Args       amqp.Table
+}
+
+type Queue struct {
+	Name       string
+	Durable    bool
+	AutoDelete bool
+	Exclusive  bool
+	// MessageTTL, MaxLength and dead letter settings are zero when not used
+	MessageTTL           time.Duration
+	MaxLength            int
+	DeadLetterExchange   string
+	DeadLetterRoutingKey string
+	Args                 amqp.Table
+}
+
+type Binding struct {
+	Queue      string
+	Exchange   string
+	RoutingKey string
+	Args       amqp.Table
+}
+
+type Topology struct {
+	Exchanges []Exchange
+	Queues    []Queue
+	Bindings  []Binding
+}
+
+func (t *Topology) Validate() error {
+	var problems []string
+	addProblem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	exchanges := make(map[string]bool, len(t.Exchanges))
+	for _, exchange := range t.Exchanges {
+		switch {
+		case exchange.Name == "":
+			addProblem("exchange name is empty")
+		case exchanges[exchange.Name]:
+			addProblem("exchange %s is declared twice", exchange.Name)
+		case strings.HasPrefix(exchange.Name, predeclaredExchangePrefix):
+			addProblem("exchange %s uses reserved prefix", exchange.Name)
+		}
+		if !isValidExchangeKind(exchange.Kind) {
+			addProblem("exchange %s has unknown kind %q", exchange.Name, exchange.Kind)
+		}
+		exchanges[exchange.Name] = true
+	}
+
+	queues := make(map[string]bool, len(t.Queues))
+	for _, queue := range t.Queues {
+		switch {
+		case queue.Name == "":
+			addProblem("queue name is empty")
+		case queues[queue.Name]:
+			addProblem("queue %s is declared twice", queue.Name)
+		}
+		if queue.MessageTTL < 0 {
+			addProblem("queue %s has negative message ttl", queue.Name)
+		}
+		if queue.MaxLength < 0 {
+			addProblem("queue %s has negative max length", queue.Name)
+		}
+		queues[queue.Name] = true
+	}
+
+	isKnownExchange := func(name string) bool {
+		return exchanges[name] || strings.HasPrefix(name, predeclaredExchangePrefix)
+	}
+
+	for _, binding := range t.Bindings {
+		if !queues[binding.Queue] {
+			addProblem("binding refers to undeclared queue %s", binding.Queue)
+		}
+		if !isKnownExchange(binding.Exchange) {
+			addProblem("binding of queue %s refers to undeclared exchange %s", binding.Queue, binding.Exchange)
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.Wrap(ErrInvalidTopology, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// DeclareTopology declares exchanges, queues and bindings, declarations are idempotent while settings are unchanged
+func DeclareTopology(channel BrokerChannel, topology *Topology) error {
+	if err := topology.Validate(); err != nil {
+		return err
+	}
+
+	for _, exchange := range topology.Exchanges {
+		err := channel.ExchangeDeclare(exchange.Name, exchange.Kind, exchange.Durable, exchange.AutoDelete, exchange.Internal, false, exchange.Args)
+		if err != nil {
+			return errors.Wrapf(err, "failed to declare exchange %s", exchange.Name)
+		}
+	}
+
+	for _, queue := range topology.Queues {
+		_, err := channel.QueueDeclare(queue.Name, queue.Durable, queue.AutoDelete, queue.Exclusive, false, queue.arguments())
+		if err != nil {
+			return errors.Wrapf(err, "failed to declare queue %s", queue.Name)
+		}
+	}
+
+	for _, binding := range topology.Bindings {
+		err := channel.QueueBind(binding.Queue, binding.RoutingKey, binding.Exchange, false, binding.Args)
+		if err != nil {
+			return errors.Wrapf(err, "failed to bind queue %s to %s", binding.Queue, binding.Exchange)
+		}
+	}
+
+	return nil
+}
+
+type TopologyChannel interface {
+	Channel
+	ChannelConnector
+}
+
+// NewTopologyChannel declares topology on every connect, add it to Connection before channels that use topology
+func NewTopologyChannel(topology Topology) TopologyChannel {
+	return &topologyChannel{topology: topology}
+}
+
+type topologyChannel struct {
+	topology Topology
+}
+
+func (t *topologyChannel) Connect(conn *amqp.Connection) error {
+	if err := t.topology.Validate(); err != nil {
+		return err
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		return errors.Wrap(err, "failed to open channel")
+	}
+
+	err = DeclareTopology(channel, &t.topology)
+	closeErr := channel.Close()
+	if err != nil {
+		return err
+	}
+	return errors.Wrap(closeErr, "failed to close channel")
+}
+
+func (t *topologyChannel) ConnectChannel(channel BrokerChannel) error {
+	return DeclareTopology(channel, &t.topology)
+}
+
+func (q *Queue) arguments() amqp.Table {
+	args := amqp.Table{}
+	for key, value := range q.Args {
+		args[key] = value
+	}
+	if q.MessageTTL > 0 {
+		args["x-message-ttl"] = q.MessageTTL.Milliseconds()
+	}
+	if q.MaxLength > 0 {
+		args["x-max-length"] = int64(q.MaxLength)
+	}
+	// routing key without exchange dead letters to default exchange
+	if q.DeadLetterExchange != "" || q.DeadLetterRoutingKey != "" {
+		args["x-dead-letter-exchange"] = q.DeadLetterExchange
+	}
+	if q.DeadLetterRoutingKey != "" {
+		args["x-dead-letter-routing-key"] = q.DeadLetterRoutingKey
+	}
+	return args
+}
+
+func isValidExchangeKind(kind string) bool {
+	switch kind {
+	case amqp.ExchangeDirect, amqp.ExchangeFanout, amqp.ExchangeTopic, amqp.ExchangeHeaders:
+		return true
+	}
+	// exchange types provided by plugins
+	return strings.HasPrefix(kind, "x-")
+}
@@ -0,0 +1,41 @@
+package eventbus
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/CuriosityMusicStreaming/ComponentsPool/pkg/app/eventbus"
+)
+
+type debugInfo struct {
+	Subscriptions []eventbus.EventSubscriptions `json:"subscriptions"`
+	Stats         []eventbus.EventStats         `json:"stats"`
+}
+
+// NewDebugHandler serves bus subscriptions and stats as JSON
+func NewDebugHandler(inspector eventbus.BusInspector) http.Handler {
+	return &debugHandler{inspector: inspector}
+}
+
+type debugHandler struct {
+	inspector eventbus.BusInspector
+}
+
+func (h *debugHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := json.Marshal(debugInfo{
+		Subscriptions: h.inspector.Subscriptions(),
+		Stats:         h.inspector.Stats(),
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
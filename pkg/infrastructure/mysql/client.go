@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 
 	"github.com/jmoiron/sqlx"
@@ -18,6 +19,17 @@ type Client interface {
 	Get(dest interface{}, query string, args ...interface{}) error
 	NamedQuery(query string, arg interface{}) (*sqlx.Rows, error)
 	NamedExec(query string, arg interface{}) (sql.Result, error)
+
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+
+	QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error)
+	QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row
+
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error)
 }
 
 type Transaction interface {
@@ -26,9 +38,16 @@ type Transaction interface {
 	Rollback() error
 }
 
+type TransactionOptions struct {
+	// Isolation is default isolation level of server when zero
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+}
+
 type TransactionalClient interface {
 	Client
 	BeginTransaction() (Transaction, error)
+	BeginTransactionContext(ctx context.Context, opts TransactionOptions) (Transaction, error)
 }
 
 type transactionalClient struct {
@@ -38,3 +57,10 @@ type transactionalClient struct {
 func (t *transactionalClient) BeginTransaction() (Transaction, error) {
 	return t.Beginx()
 }
+
+func (t *transactionalClient) BeginTransactionContext(ctx context.Context, opts TransactionOptions) (Transaction, error) {
+	return t.BeginTxx(ctx, &sql.TxOptions{
+		Isolation: opts.Isolation,
+		ReadOnly:  opts.ReadOnly,
+	})
+}
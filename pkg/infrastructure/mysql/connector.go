@@ -2,11 +2,9 @@
 package mysql
 
 import (
-	"fmt"
 	"time"
 
 	"github.com/cenkalti/backoff"
-	_ "github.com/go-sql-driver/mysql"                   // provides MySQL driver
 	_ "github.com/golang-migrate/migrate/v4/source/file" // provides filesystem source
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
@@ -18,58 +16,146 @@ const (
 	maxReconnectWaitingTime = 15 * time.Second
 )
 
-type DSN struct {
-	User     string
-	Password string
-	Host     string
-	Database string
-}
-
-func (dsn *DSN) String() string {
-	return fmt.Sprintf("%s:%s@(%s)/%s?charset=utf8mb4&parseTime=true", dsn.User, dsn.Password, dsn.Host, dsn.Database)
-}
-
 type Connector interface {
 	Open(dsn DSN, maxConnections int) error
+	OpenWithPool(dsn DSN, pool PoolConfig) error
 	MigrateUp(dsn DSN, migrationsProvider MigrationProvider) error
+	// MigrateDown rolls back last steps migrations
+	MigrateDown(dsn DSN, migrationsProvider MigrationProvider, steps int) error
+	// MigrateTo applies or rolls back migrations so version is last applied migration
+	MigrateTo(dsn DSN, migrationsProvider MigrationProvider, version string) error
+	// MigrationStatus and PlanMigration don't wait for migration lock, so they may observe migration in progress
+	MigrationStatus(dsn DSN, migrationsProvider MigrationProvider) ([]MigrationStatus, error)
+	// PlanMigration returns migrations with SQL that would be executed for target without executing them
+	PlanMigration(dsn DSN, migrationsProvider MigrationProvider, target MigrationTarget) ([]PlannedMigration, error)
+	// OpenReplicas opens read replicas of database opened by Open, replicas which are down are used after they recover.
+	// It can be called once, replicas are closed by Close
+	OpenReplicas(replicas []DSN, maxConnections int) error
+	OpenReplicasWithPool(replicas []DSN, pool PoolConfig) error
 	Client() Client
 	TransactionalClient() TransactionalClient
+	// ReplicatedClient can be made before OpenReplicas, it reads from primary until replicas are opened
+	ReplicatedClient() ReplicatedClient
 	Close() error
 }
 
 type connector struct {
-	db *sqlx.DB
+	db                  *sqlx.DB
+	replicas            replicaSet
+	stopHealthCheckChan chan struct{}
 }
 
 func NewConnector() Connector {
 	return &connector{}
 }
 
+// MigrateUp applies migrations under migration lock, instances waiting for lock verify that schema is current
 func (c *connector) MigrateUp(dsn DSN, migrationsProvider MigrationProvider) error {
-	db, err := openDB(dsn, 1)
-	if err != nil {
-		return errors.WithStack(err)
-	}
+	return withLockedMigrationDB(dsn, func(db *sqlx.DB) error {
+		source := makeMigrationSource(migrationsProvider)
+		_, err := executeMigration(db, source, MigrationTarget{Direction: MigrationUp})
+		if err != nil {
+			return err
+		}
 
-	_, err = migrate.Exec(db.DB, dbDriverName, makeMigrationSource(migrationsProvider), migrate.Up)
-	if err != nil {
-		return errors.Wrap(err, "failed to migrate")
+		pending, err := planMigration(db, source, MigrationTarget{Direction: MigrationUp})
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return errors.Wrapf(ErrSchemaNotCurrent, "%d migrations are not applied", len(pending))
+		}
+		return nil
+	})
+}
+
+func (c *connector) MigrateDown(dsn DSN, migrationsProvider MigrationProvider, steps int) error {
+	if steps <= 0 {
+		return nil
 	}
+	return c.migrate(dsn, migrationsProvider, MigrationTarget{Direction: MigrationDown, Steps: steps})
+}
 
-	return nil
+func (c *connector) MigrateTo(dsn DSN, migrationsProvider MigrationProvider, version string) error {
+	return c.migrate(dsn, migrationsProvider, MigrationTarget{Version: version})
+}
+
+func (c *connector) MigrationStatus(dsn DSN, migrationsProvider MigrationProvider) (result []MigrationStatus, err error) {
+	err = withMigrationDB(dsn, func(db *sqlx.DB) error {
+		result, err = migrationStatus(db, makeMigrationSource(migrationsProvider))
+		return err
+	})
+	return result, err
+}
+
+func (c *connector) PlanMigration(dsn DSN, migrationsProvider MigrationProvider, target MigrationTarget) (result []PlannedMigration, err error) {
+	err = withMigrationDB(dsn, func(db *sqlx.DB) error {
+		result, err = planMigration(db, makeMigrationSource(migrationsProvider), target)
+		return err
+	})
+	return result, err
+}
+
+func (c *connector) migrate(dsn DSN, migrationsProvider MigrationProvider, target MigrationTarget) error {
+	return withLockedMigrationDB(dsn, func(db *sqlx.DB) error {
+		_, err := executeMigration(db, makeMigrationSource(migrationsProvider), target)
+		return err
+	})
 }
 
 func (c *connector) Open(dsn DSN, maxConnections int) error {
+	return c.OpenWithPool(dsn, PoolConfig{MaxOpenConnections: maxConnections})
+}
+
+func (c *connector) OpenWithPool(dsn DSN, pool PoolConfig) error {
 	var err error
-	c.db, err = openDB(dsn, maxConnections)
+	c.db, err = openDB(dsn, pool)
 	return errors.WithStack(err)
 }
 
+func (c *connector) OpenReplicas(replicas []DSN, maxConnections int) error {
+	return c.OpenReplicasWithPool(replicas, PoolConfig{MaxOpenConnections: maxConnections})
+}
+
+func (c *connector) OpenReplicasWithPool(replicas []DSN, pool PoolConfig) error {
+	if c.stopHealthCheckChan != nil {
+		return errors.WithStack(ErrReplicasAlreadyOpened)
+	}
+
+	opened := make([]*replica, 0, len(replicas))
+	for _, dsn := range replicas {
+		r, err := openReplica(dsn, pool)
+		if err != nil {
+			for _, openedReplica := range opened {
+				_ = openedReplica.db.Close()
+			}
+			return err
+		}
+		opened = append(opened, r)
+	}
+
+	c.replicas.set(opened)
+	c.stopHealthCheckChan = make(chan struct{})
+	go runReplicaHealthChecks(opened, c.stopHealthCheckChan)
+	return nil
+}
+
 func (c *connector) Close() error {
+	c.closeReplicas()
 	err := c.db.Close()
 	return errors.Wrap(err, "failed to disconnect")
 }
 
+func (c *connector) closeReplicas() {
+	if c.stopHealthCheckChan != nil {
+		close(c.stopHealthCheckChan)
+		c.stopHealthCheckChan = nil
+	}
+	for _, r := range c.replicas.set(nil) {
+		_ = r.db.Close()
+	}
+}
+
 func (c *connector) Client() Client {
 	return c.db
 }
@@ -78,13 +164,20 @@ func (c *connector) TransactionalClient() TransactionalClient {
 	return &transactionalClient{c.db}
 }
 
-func openDB(dsn DSN, maxConnections int) (*sqlx.DB, error) {
+func (c *connector) ReplicatedClient() ReplicatedClient {
+	return &replicatedClient{
+		transactionalClient: &transactionalClient{c.db},
+		replicas:            &c.replicas,
+	}
+}
+
+func openDB(dsn DSN, pool PoolConfig) (*sqlx.DB, error) {
 	db, err := sqlx.Open(dbDriverName, dsn.String())
 	if err != nil {
 		return nil, errors.Wrapf(err, "failed to open database")
 	}
 
-	db.SetMaxOpenConns(maxConnections)
+	pool.apply(db.DB)
 
 	err = backoff.Retry(func() error {
 		tryError := db.Ping()
@@ -100,6 +193,31 @@ func openDB(dsn DSN, maxConnections int) (*sqlx.DB, error) {
 	return db, errors.WithStack(err)
 }
 
+// withLockedMigrationDB runs f under migration lock, it is used by operations which execute migrations
+func withLockedMigrationDB(dsn DSN, f func(db *sqlx.DB) error) error {
+	return withMigrationDB(dsn, func(db *sqlx.DB) error {
+		return withMigrationLock(db, func() error {
+			return f(db)
+		})
+	})
+}
+
+// withMigrationDB runs f without migration lock, so reading status is not blocked by running migration
+func withMigrationDB(dsn DSN, f func(db *sqlx.DB) error) error {
+	// one connection holds migration lock and another one runs migrations
+	db, err := openDB(dsn, PoolConfig{MaxOpenConnections: 2})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = f(db)
+	closeErr := db.Close()
+	if err == nil && closeErr != nil {
+		err = errors.Wrap(closeErr, "failed to disconnect")
+	}
+	return err
+}
+
 func makeMigrationSource(migrationsProvider MigrationProvider) migrate.MigrationSource {
 	return migrate.HttpFileSystemMigrationSource{FileSystem: migrationsProvider.GetDir()}
 }
@@ -0,0 +1,153 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+type transactionKey struct{}
+
+func ContextWithTransaction(ctx context.Context, tx Transaction) context.Context {
+	return context.WithValue(ctx, transactionKey{}, tx)
+}
+
+func TransactionFromContext(ctx context.Context) (Transaction, bool) {
+	tx, ok := ctx.Value(transactionKey{}).(Transaction)
+	return tx, ok
+}
+
+// WithContextTransaction runs fn with transaction stored in ctx, so clients made by NewContextClient join it.
+// When ctx already has transaction fn joins it and commit is left to outer call
+func WithContextTransaction(ctx context.Context, client TransactionalClient, fn func(ctx context.Context) error) error {
+	if _, ok := TransactionFromContext(ctx); ok {
+		return fn(ctx)
+	}
+
+	return WithTransaction(ctx, client, func(tx Transaction) error {
+		return fn(ContextWithTransaction(ctx, tx))
+	})
+}
+
+// NewContextClient makes client which Context methods use transaction from context if it is present.
+//
+// Only Context methods join transaction: methods without context always use client, so repositories
+// have to call Context methods, e.g. GetContext instead of Get, to take part in transaction started higher up.
+// BeginTransactionContext joins transaction from context too, commit and rollback of joined transaction are left to outer call
+func NewContextClient(client TransactionalClient) TransactionalClient {
+	return &contextClient{client: client}
+}
+
+type contextClient struct {
+	client TransactionalClient
+}
+
+func (c *contextClient) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.client.Query(query, args...)
+}
+
+func (c *contextClient) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.client.QueryRow(query, args...)
+}
+
+func (c *contextClient) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.client.Exec(query, args...)
+}
+
+func (c *contextClient) Queryx(query string, args ...interface{}) (*sqlx.Rows, error) {
+	return c.client.Queryx(query, args...)
+}
+
+func (c *contextClient) QueryRowx(query string, args ...interface{}) *sqlx.Row {
+	return c.client.QueryRowx(query, args...)
+}
+
+func (c *contextClient) Select(dest interface{}, query string, args ...interface{}) error {
+	return c.client.Select(dest, query, args...)
+}
+
+func (c *contextClient) Get(dest interface{}, query string, args ...interface{}) error {
+	return c.client.Get(dest, query, args...)
+}
+
+func (c *contextClient) NamedQuery(query string, arg interface{}) (*sqlx.Rows, error) {
+	return c.client.NamedQuery(query, arg)
+}
+
+func (c *contextClient) NamedExec(query string, arg interface{}) (sql.Result, error) {
+	return c.client.NamedExec(query, arg)
+}
+
+func (c *contextClient) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return c.clientFor(ctx).QueryContext(ctx, query, args...)
+}
+
+func (c *contextClient) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return c.clientFor(ctx).QueryRowContext(ctx, query, args...)
+}
+
+func (c *contextClient) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return c.clientFor(ctx).ExecContext(ctx, query, args...)
+}
+
+func (c *contextClient) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	return c.clientFor(ctx).QueryxContext(ctx, query, args...)
+}
+
+func (c *contextClient) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	return c.clientFor(ctx).QueryRowxContext(ctx, query, args...)
+}
+
+func (c *contextClient) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return c.clientFor(ctx).SelectContext(ctx, dest, query, args...)
+}
+
+func (c *contextClient) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return c.clientFor(ctx).GetContext(ctx, dest, query, args...)
+}
+
+func (c *contextClient) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	return c.clientFor(ctx).NamedExecContext(ctx, query, arg)
+}
+
+func (c *contextClient) BeginTransaction() (Transaction, error) {
+	return c.client.BeginTransaction()
+}
+
+func (c *contextClient) BeginTransactionContext(ctx context.Context, opts TransactionOptions) (Transaction, error) {
+	if tx, ok := TransactionFromContext(ctx); ok {
+		return joinedTransaction{Transaction: tx}, nil
+	}
+	return c.client.BeginTransactionContext(ctx, opts)
+}
+
+// Conn makes client usable for NewLock when wrapped client provides connections
+func (c *contextClient) Conn(ctx context.Context) (*sql.Conn, error) {
+	db, ok := c.client.(ConnProvider)
+	if !ok {
+		return nil, errors.WithStack(ErrConnNotProvided)
+	}
+	return db.Conn(ctx)
+}
+
+// joinedTransaction is transaction from context used by nested code, outer call commits or rolls it back
+type joinedTransaction struct {
+	Transaction
+}
+
+func (t joinedTransaction) Commit() error {
+	return nil
+}
+
+func (t joinedTransaction) Rollback() error {
+	return nil
+}
+
+func (c *contextClient) clientFor(ctx context.Context) Client {
+	if tx, ok := TransactionFromContext(ctx); ok {
+		return tx
+	}
+	return c.client
+}
@@ -0,0 +1,55 @@
+package mysql
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDSNRoundTrip(t *testing.T) {
+	cases := []string{
+		"user:pass@tcp(localhost:3306)/db?parseTime=true&charset=utf8mb4",
+		"user:pass@unix(/var/run/mysqld.sock)/db?parseTime=true&charset=utf8mb4",
+		"user:pass@tcp(db:3306)/db?interpolateParams=true&parseTime=true&timeout=5s&tls=skip-verify&charset=utf8mb4&foo=bar",
+		"u:p@tcp(h:3306)/db?allowNativePasswords=false&checkConnLiveness=false&clientFoundRows=true&columnsWithAlias=true&multiStatements=true&parseTime=true&rejectReadOnly=true&maxAllowedPacket=0&charset=utf8mb4",
+	}
+	for _, s := range cases {
+		dsn, err := ParseDSN(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := dsn.String(); actual != s {
+			t.Errorf("expected %s, got %s", s, actual)
+		}
+	}
+}
+
+func TestParseDSNFromURL(t *testing.T) {
+	dsn, err := ParseDSN("mysql://user:p%40ss@db:3306/app?timeout=5s&interpolateParams=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dsn.User != "user" || dsn.Password != "p@ss" || dsn.Host != "db:3306" || dsn.Database != "app" || dsn.Net != "tcp" {
+		t.Fatalf("unexpected dsn %+v", dsn)
+	}
+	if dsn.Timeout != 5*time.Second || !dsn.InterpolateParams {
+		t.Fatalf("unexpected options %+v", dsn)
+	}
+
+	dsn, err = ParseDSN("mysql://user:pass@db:3306/app?multiStatements=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "user:pass@tcp(db:3306)/app?multiStatements=true&parseTime=true&charset=utf8mb4"
+	if actual := dsn.String(); actual != expected {
+		t.Fatalf("expected %s, got %s", expected, actual)
+	}
+}
+
+func TestDSNStringKeepsDefaults(t *testing.T) {
+	dsn := DSN{User: "user", Password: "pass", Host: "db:3306", Database: "app"}
+	expected := "user:pass@tcp(db:3306)/app?parseTime=true&charset=utf8mb4"
+	if actual := dsn.String(); actual != expected {
+		t.Fatalf("expected %s, got %s", expected, actual)
+	}
+}
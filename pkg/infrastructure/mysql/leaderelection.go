@@ -0,0 +1,154 @@
+package mysql
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/CuriosityMusicStreaming/ComponentsPool/pkg/app/logger"
+	"github.com/CuriosityMusicStreaming/ComponentsPool/pkg/infrastructure/server"
+)
+
+const defaultLeaderRetryInterval = 5 * time.Second
+
+type LeaderElectionConfig struct {
+	// Name is name of lock, instances with the same name compete for leadership
+	Name string
+	// RetryInterval is interval between attempts to become leader
+	RetryInterval time.Duration
+	Lock          LockConfig
+	OnElected     func()
+	OnLost        func()
+}
+
+// ServerFactory makes inner server for every term of leadership, so servers that can't be served after Stop work
+type ServerFactory func() server.Server
+
+// LeaderElection is server.Server which competes for leadership while served and runs inner server only while it is leader.
+// When inner server finishes with nil leadership is released and election goes on, when it fails Serve returns its error
+type LeaderElection interface {
+	server.Server
+	IsLeader() bool
+}
+
+func NewLeaderElection(db ConnProvider, cfg LeaderElectionConfig, newServer ServerFactory, logger log.Logger) LeaderElection {
+	if cfg.RetryInterval == 0 {
+		cfg.RetryInterval = defaultLeaderRetryInterval
+	}
+	return &leaderElection{
+		cfg:       cfg,
+		lock:      NewLockWithConfig(db, cfg.Name, cfg.Lock),
+		newServer: newServer,
+		logger:    logger,
+		stopChan:  make(chan struct{}),
+	}
+}
+
+type leaderElection struct {
+	cfg       LeaderElectionConfig
+	lock      Lock
+	newServer ServerFactory
+	logger    log.Logger
+	leader    int32
+	stopChan  chan struct{}
+	stopOnce  sync.Once
+}
+
+func (e *leaderElection) Serve() error {
+	for {
+		acquired, err := e.lock.TryLock()
+		if err != nil {
+			e.logger.Error(err, "failed to acquire leadership ", e.cfg.Name)
+		}
+
+		if acquired {
+			stopped, leadErr := e.lead()
+			if stopped || leadErr != nil {
+				return leadErr
+			}
+		}
+
+		select {
+		case <-time.After(e.cfg.RetryInterval):
+		case <-e.stopChan:
+			return nil
+		}
+	}
+}
+
+func (e *leaderElection) Stop() error {
+	e.stopOnce.Do(func() {
+		close(e.stopChan)
+	})
+	return nil
+}
+
+func (e *leaderElection) IsLeader() bool {
+	return atomic.LoadInt32(&e.leader) == 1
+}
+
+// lead runs inner server of new term until leadership is lost, inner server finishes or election is stopped
+func (e *leaderElection) lead() (stopped bool, err error) {
+	lost := e.lock.Lost()
+	e.setLeader(true)
+	e.logger.Info("became leader ", e.cfg.Name)
+
+	var inner server.Server
+	innerDone := make(chan error, 1)
+	if e.newServer != nil {
+		inner = e.newServer()
+		go func() {
+			innerDone <- inner.Serve()
+		}()
+	}
+
+	select {
+	case <-lost:
+		e.logger.Info("leadership is lost ", e.cfg.Name)
+		e.stopInner(inner, innerDone)
+		e.setLeader(false)
+		_ = e.lock.Unlock()
+		return false, nil
+	case <-e.stopChan:
+		e.stopInner(inner, innerDone)
+		e.setLeader(false)
+		return true, e.lock.Unlock()
+	case err = <-innerDone:
+		e.setLeader(false)
+		unlockErr := e.lock.Unlock()
+		if err != nil {
+			return true, err
+		}
+		if unlockErr != nil {
+			e.logger.Error(unlockErr, "failed to release leadership ", e.cfg.Name)
+		}
+		e.logger.Info("server of leader is finished, leadership is released ", e.cfg.Name)
+		return false, nil
+	}
+}
+
+func (e *leaderElection) stopInner(inner server.Server, innerDone chan error) {
+	if inner == nil {
+		return
+	}
+	if err := inner.Stop(); err != nil {
+		e.logger.Error(err, "failed to stop server of leader ", e.cfg.Name)
+	}
+	<-innerDone
+}
+
+func (e *leaderElection) setLeader(leader bool) {
+	var value int32
+	if leader {
+		value = 1
+	}
+	atomic.StoreInt32(&e.leader, value)
+
+	callback := e.cfg.OnLost
+	if leader {
+		callback = e.cfg.OnElected
+	}
+	if callback != nil {
+		callback()
+	}
+}
@@ -1,47 +1,203 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
-const timeoutInSeconds = 5
+const (
+	defaultLockTimeout       = 5 * time.Second
+	defaultKeepAliveInterval = 10 * time.Second
+)
 
 var (
 	ErrLockTimeout     = errors.New("timeout is reached for lock")
 	ErrLockNotFound    = errors.New("lock not found")
 	ErrLockNotAcquired = errors.New("lock not acquired")
+	ErrLockLost        = errors.New("lock is lost because connection is lost")
+	ErrConnNotProvided = errors.New("client doesn't provide dedicated connections")
 )
 
-func NewLock(client Client, lockName string) Lock {
-	return Lock{
-		client:           client,
-		lockName:         lockName,
-		timeoutInSeconds: timeoutInSeconds,
+// ConnProvider provides dedicated connections, *sqlx.DB and clients of Connector implement it
+type ConnProvider interface {
+	Conn(ctx context.Context) (*sql.Conn, error)
+}
+
+type LockConfig struct {
+	// Timeout is how long Lock waits for lock, negative value means infinite waiting
+	Timeout time.Duration
+	// KeepAliveInterval is interval of pinging connection holding lock to detect that lock is lost
+	KeepAliveInterval time.Duration
+}
+
+// Lock is MySQL named lock, it holds dedicated connection while lock is acquired since named locks belong to session.
+// Goroutines sharing one Lock wait for each other like with sync.Mutex.
+// Lock is reentrant only for owner marked by WithLockOwner: LockContext called again with ctx of the same owner
+// doesn't wait and lock is released after matching number of Unlock calls. Lock called again without owner waits until timeout
+type Lock interface {
+	Lock() error
+	LockContext(ctx context.Context) error
+	// TryLock acquires lock without waiting, it returns false when lock is held by another session or goroutine
+	TryLock() (bool, error)
+	Unlock() error
+	// Lost is closed when connection holding lock is lost, it is nil when lock is not acquired
+	Lost() <-chan struct{}
+}
+
+type lockOwnerKey struct{}
+
+type lockOwner struct{}
+
+// WithLockOwner returns ctx of new lock owner, locks acquired by LockContext with it are reentrant for it
+func WithLockOwner(ctx context.Context) context.Context {
+	return context.WithValue(ctx, lockOwnerKey{}, &lockOwner{})
+}
+
+func ownerFromContext(ctx context.Context) *lockOwner {
+	owner, _ := ctx.Value(lockOwnerKey{}).(*lockOwner)
+	return owner
+}
+
+// NewLock makes lock with default config, clients of Connector provide connections
+func NewLock(db ConnProvider, lockName string) Lock {
+	return NewLockWithConfig(db, lockName, LockConfig{})
+}
+
+func NewLockWithConfig(db ConnProvider, lockName string, cfg LockConfig) Lock {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultLockTimeout
+	}
+	if cfg.KeepAliveInterval == 0 {
+		cfg.KeepAliveInterval = defaultKeepAliveInterval
+	}
+	return &lock{
+		db:       db,
+		lockName: lockName,
+		cfg:      cfg,
+		holder:   make(chan struct{}, 1),
 	}
 }
 
-type Lock struct {
-	client           Client
-	lockName         string
-	timeoutInSeconds int
+type lock struct {
+	db       ConnProvider
+	lockName string
+	cfg      LockConfig
+	// holder is filled while goroutine holds or acquires lock, it excludes goroutines sharing lock
+	holder chan struct{}
+
+	// mutex guards connection state and ownership, it is never held during network round trips
+	mutex sync.Mutex
+	// owner holds lock depth times, owner is nil when lock is acquired without WithLockOwner
+	owner         *lockOwner
+	depth         int
+	conn          *sql.Conn
+	lost          chan struct{}
+	stopKeepAlive chan struct{}
+	keepAliveDone chan struct{}
 }
 
-func (l *Lock) Lock() error {
-	const sqlQuery = `SELECT GET_LOCK(SUBSTRING(CONCAT(?, '.', DATABASE()), 1, 64), ?)`
-	var result int
-	err := l.client.Get(&result, sqlQuery, l.lockName, l.timeoutInSeconds)
-	if result == 0 && err == nil {
-		return ErrLockTimeout
+func (l *lock) Lock() error {
+	return l.LockContext(context.Background())
+}
+
+func (l *lock) LockContext(ctx context.Context) error {
+	owner := ownerFromContext(ctx)
+	if owner != nil && l.reenter(owner) {
+		return nil
 	}
-	return errors.WithStack(err)
+
+	start := time.Now()
+
+	waitCtx := ctx
+	if l.cfg.Timeout >= 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, l.cfg.Timeout)
+		defer cancel()
+	}
+
+	select {
+	case l.holder <- struct{}{}:
+	case <-waitCtx.Done():
+		if ctx.Err() != nil {
+			return errors.Wrap(ctx.Err(), "waiting for lock is cancelled")
+		}
+		return errors.WithStack(ErrLockTimeout)
+	}
+
+	timeoutInSeconds := -1.0
+	if l.cfg.Timeout >= 0 {
+		remaining := l.cfg.Timeout - time.Since(start)
+		if remaining < 0 {
+			remaining = 0
+		}
+		timeoutInSeconds = remaining.Seconds()
+	}
+
+	acquired, err := l.acquire(ctx, owner, timeoutInSeconds)
+	if err == nil && !acquired {
+		err = ErrLockTimeout
+	}
+	if err != nil {
+		<-l.holder
+	}
+	return err
 }
 
-func (l *Lock) Unlock() error {
+func (l *lock) TryLock() (bool, error) {
+	select {
+	case l.holder <- struct{}{}:
+	default:
+		return false, nil
+	}
+
+	acquired, err := l.acquire(context.Background(), nil, 0)
+	if err != nil || !acquired {
+		<-l.holder
+	}
+	return acquired, err
+}
+
+func (l *lock) Unlock() error {
+	l.mutex.Lock()
+	if l.depth > 1 {
+		l.depth--
+		l.mutex.Unlock()
+		return nil
+	}
+	l.owner = nil
+	l.depth = 0
+
+	if l.conn == nil {
+		lost := l.lost != nil
+		l.lost = nil
+		l.mutex.Unlock()
+		if lost {
+			<-l.holder
+			return errors.WithStack(ErrLockLost)
+		}
+		return errors.WithStack(ErrLockNotAcquired)
+	}
+
+	conn, stopKeepAlive, keepAliveDone := l.conn, l.stopKeepAlive, l.keepAliveDone
+	l.conn = nil
+	l.lost = nil
+	l.mutex.Unlock()
+
+	defer func() {
+		<-l.holder
+	}()
+
+	close(stopKeepAlive)
+	<-keepAliveDone
+	defer conn.Close()
+
 	const sqlQuery = `SELECT RELEASE_LOCK(SUBSTRING(CONCAT(?, '.', DATABASE()), 1, 64))`
 	var result sql.NullInt32
-	err := l.client.Get(&result, sqlQuery, l.lockName)
+	err := conn.QueryRowContext(context.Background(), sqlQuery, l.lockName).Scan(&result)
 	if err == nil {
 		if !result.Valid {
 			return ErrLockNotFound
@@ -52,3 +208,82 @@ func (l *Lock) Unlock() error {
 	}
 	return errors.WithStack(err)
 }
+
+func (l *lock) Lost() <-chan struct{} {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.lost
+}
+
+// reenter increments depth when owner holds lock, lost lock is reentered too and loss is reported by last Unlock
+func (l *lock) reenter(owner *lockOwner) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.owner != owner || l.depth == 0 {
+		return false
+	}
+	l.depth++
+	return true
+}
+
+// acquire is called by goroutine which filled holder, so connection state is not changed concurrently
+func (l *lock) acquire(ctx context.Context, owner *lockOwner, timeoutInSeconds float64) (bool, error) {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get connection for lock")
+	}
+
+	const sqlQuery = `SELECT GET_LOCK(SUBSTRING(CONCAT(?, '.', DATABASE()), 1, 64), ?)`
+	var result sql.NullInt32
+	err = conn.QueryRowContext(ctx, sqlQuery, l.lockName, timeoutInSeconds).Scan(&result)
+	if err != nil || !result.Valid || result.Int32 == 0 {
+		_ = conn.Close()
+		return false, errors.WithStack(err)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.owner = owner
+	l.depth = 1
+	l.conn = conn
+	l.lost = make(chan struct{})
+	l.stopKeepAlive = make(chan struct{})
+	l.keepAliveDone = make(chan struct{})
+	go l.keepAlive(conn, l.lost, l.stopKeepAlive, l.keepAliveDone)
+
+	return true, nil
+}
+
+func (l *lock) keepAlive(conn *sql.Conn, lost, stop, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(l.cfg.KeepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := conn.PingContext(context.Background()); err != nil {
+				l.markLost(conn, lost)
+				return
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// markLost keeps holder filled, so holder finds out about loss on Unlock
+func (l *lock) markLost(conn *sql.Conn, lost chan struct{}) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.conn != conn {
+		return
+	}
+	l.conn = nil
+	close(lost)
+	_ = conn.Close()
+}
@@ -0,0 +1,207 @@
+package mysql
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+type MigrationDirection int
+
+const (
+	MigrationUp MigrationDirection = iota
+	MigrationDown
+)
+
+func (d MigrationDirection) String() string {
+	if d == MigrationDown {
+		return "down"
+	}
+	return "up"
+}
+
+var ErrUnknownMigration = errors.New("unknown migration")
+
+// MigrationTarget describes which migrations should be applied or rolled back
+type MigrationTarget struct {
+	Direction MigrationDirection
+	// Steps limits number of migrations, zero means all
+	Steps int
+	// Version is id of migration that should be last applied, Direction and Steps are ignored when it is set
+	Version string
+}
+
+type PlannedMigration struct {
+	ID        string
+	Direction MigrationDirection
+	Queries   []string
+}
+
+type MigrationStatus struct {
+	ID      string
+	Applied bool
+	// AppliedAt is nil for pending migrations
+	AppliedAt *time.Time
+	// Missing is true for applied migrations that are not provided by MigrationProvider
+	Missing bool
+}
+
+// WriteMigrationPlan writes SQL of planned migrations, it is used for dry run
+func WriteMigrationPlan(w io.Writer, plan []PlannedMigration) error {
+	for _, migration := range plan {
+		_, err := fmt.Fprintf(w, "-- %s %s\n", migration.Direction, migration.ID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		for _, query := range migration.Queries {
+			_, err = fmt.Fprintln(w, query)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+	return nil
+}
+
+func executeMigration(db *sqlx.DB, source migrate.MigrationSource, target MigrationTarget) (int, error) {
+	direction, steps, err := resolveMigrationTarget(db, source, target)
+	if err != nil {
+		return 0, err
+	}
+	if steps < 0 {
+		return 0, nil
+	}
+
+	n, err := migrate.ExecMax(db.DB, dbDriverName, source, toMigrateDirection(direction), steps)
+	return n, errors.Wrap(err, "failed to migrate")
+}
+
+func planMigration(db *sqlx.DB, source migrate.MigrationSource, target MigrationTarget) ([]PlannedMigration, error) {
+	direction, steps, err := resolveMigrationTarget(db, source, target)
+	if err != nil {
+		return nil, err
+	}
+	if steps < 0 {
+		return nil, nil
+	}
+
+	planned, _, err := migrate.PlanMigration(db.DB, dbDriverName, source, toMigrateDirection(direction), steps)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to plan migration")
+	}
+
+	result := make([]PlannedMigration, 0, len(planned))
+	for _, migration := range planned {
+		result = append(result, PlannedMigration{
+			ID:        migration.Id,
+			Direction: direction,
+			Queries:   migration.Queries,
+		})
+	}
+	return result, nil
+}
+
+func migrationStatus(db *sqlx.DB, source migrate.MigrationSource) ([]MigrationStatus, error) {
+	migrations, err := source.FindMigrations()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to find migrations")
+	}
+
+	records, err := migrate.GetMigrationRecords(db.DB, dbDriverName)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get migration records")
+	}
+
+	applied := make(map[string]time.Time, len(records))
+	for _, record := range records {
+		applied[record.Id] = record.AppliedAt
+	}
+
+	result := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		status := MigrationStatus{ID: migration.Id}
+		if appliedAt, ok := applied[migration.Id]; ok {
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+			delete(applied, migration.Id)
+		}
+		result = append(result, status)
+	}
+
+	for _, record := range records {
+		if _, ok := applied[record.Id]; ok {
+			appliedAt := record.AppliedAt
+			result = append(result, MigrationStatus{
+				ID:        record.Id,
+				Applied:   true,
+				AppliedAt: &appliedAt,
+				Missing:   true,
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// resolveMigrationTarget returns direction and max number of migrations for sql-migrate, negative steps mean nothing to do
+func resolveMigrationTarget(db *sqlx.DB, source migrate.MigrationSource, target MigrationTarget) (MigrationDirection, int, error) {
+	if target.Version == "" {
+		return target.Direction, target.Steps, nil
+	}
+
+	migrations, err := source.FindMigrations()
+	if err != nil {
+		return MigrationUp, 0, errors.Wrap(err, "failed to find migrations")
+	}
+
+	var version *migrate.Migration
+	for _, migration := range migrations {
+		if migration.Id == target.Version {
+			version = migration
+			break
+		}
+	}
+	if version == nil {
+		return MigrationUp, 0, errors.Wrapf(ErrUnknownMigration, "version %s", target.Version)
+	}
+
+	pending, _, err := migrate.PlanMigration(db.DB, dbDriverName, source, migrate.Up, 0)
+	if err != nil {
+		return MigrationUp, 0, errors.Wrap(err, "failed to plan migration")
+	}
+	steps := 0
+	for _, migration := range pending {
+		if !version.Less(migration.Migration) {
+			steps++
+		}
+	}
+	if steps > 0 {
+		return MigrationUp, steps, nil
+	}
+
+	applied, _, err := migrate.PlanMigration(db.DB, dbDriverName, source, migrate.Down, 0)
+	if err != nil {
+		return MigrationUp, 0, errors.Wrap(err, "failed to plan migration")
+	}
+	for _, migration := range applied {
+		if version.Less(migration.Migration) {
+			steps++
+		}
+	}
+	if steps > 0 {
+		return MigrationDown, steps, nil
+	}
+
+	return MigrationUp, -1, nil
+}
+
+func toMigrateDirection(direction MigrationDirection) migrate.MigrationDirection {
+	if direction == MigrationDown {
+		return migrate.Down
+	}
+	return migrate.Up
+}
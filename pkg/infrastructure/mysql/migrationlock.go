@@ -0,0 +1,37 @@
+package mysql
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+const (
+	migrationLockName    = "schema_migrations"
+	migrationLockTimeout = 10 * time.Minute
+)
+
+var ErrSchemaNotCurrent = errors.New("schema has pending migrations")
+
+// withMigrationLock runs f while holding migration lock, so only one instance migrates at once
+func withMigrationLock(db *sqlx.DB, f func() error) (err error) {
+	lock := NewLockWithConfig(db, migrationLockName, LockConfig{Timeout: migrationLockTimeout})
+	err = lock.Lock()
+	if err != nil {
+		return errors.Wrap(err, "failed to acquire migration lock")
+	}
+
+	defer func() {
+		unlockErr := lock.Unlock()
+		if unlockErr != nil {
+			if err != nil {
+				err = errors.Wrap(err, unlockErr.Error())
+			} else {
+				err = errors.Wrap(unlockErr, "failed to release migration lock")
+			}
+		}
+	}()
+
+	return f()
+}
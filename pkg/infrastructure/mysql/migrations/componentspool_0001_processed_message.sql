@@ -0,0 +1,12 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS processed_message
+(
+    consumer     VARCHAR(255) NOT NULL,
+    message_id   VARCHAR(255) NOT NULL,
+    processed_at DATETIME     NOT NULL,
+    PRIMARY KEY (consumer, message_id),
+    INDEX processed_at_idx (processed_at)
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS processed_message;
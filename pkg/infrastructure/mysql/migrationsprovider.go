@@ -1,7 +1,155 @@
 package mysql
 
-import "net/http"
+import (
+	"embed"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var ErrDuplicateMigration = errors.New("migration is provided by several providers")
 
 type MigrationProvider interface {
 	GetDir() http.FileSystem
 }
+
+//go:embed migrations/*.sql
+var libraryMigrations embed.FS
+
+// NewLibraryMigrationProvider provides migrations of tables used by components of this library
+func NewLibraryMigrationProvider() MigrationProvider {
+	provider, err := NewFSMigrationProvider(libraryMigrations, "migrations")
+	if err != nil {
+		panic(err)
+	}
+	return provider
+}
+
+// NewFSMigrationProvider provides migrations from dir of fsys, it works with embed.FS
+func NewFSMigrationProvider(fsys fs.FS, dir string) (MigrationProvider, error) {
+	sub, err := fs.Sub(fsys, dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid migrations dir %s", dir)
+	}
+	return &fsMigrationProvider{fsys: sub}, nil
+}
+
+type fsMigrationProvider struct {
+	fsys fs.FS
+}
+
+func (p *fsMigrationProvider) GetDir() http.FileSystem {
+	return http.FS(p.fsys)
+}
+
+// NewMultiMigrationProvider merges migrations of providers, migration ids must be unique across providers
+func NewMultiMigrationProvider(providers ...MigrationProvider) MigrationProvider {
+	return &multiMigrationProvider{providers: providers}
+}
+
+type multiMigrationProvider struct {
+	providers []MigrationProvider
+}
+
+func (p *multiMigrationProvider) GetDir() http.FileSystem {
+	fileSystems := make(mergedFileSystem, 0, len(p.providers))
+	for _, provider := range p.providers {
+		fileSystems = append(fileSystems, provider.GetDir())
+	}
+	return fileSystems
+}
+
+type mergedFileSystem []http.FileSystem
+
+func (m mergedFileSystem) Open(name string) (http.File, error) {
+	if name == "/" || name == "" || name == "." {
+		return &mergedRootDir{fileSystems: m}, nil
+	}
+
+	for _, fileSystem := range m {
+		file, err := fileSystem.Open(name)
+		if err == nil {
+			return file, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return nil, &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+}
+
+// mergedRootDir lists files of root dirs of all file systems
+type mergedRootDir struct {
+	fileSystems mergedFileSystem
+	listed      bool
+}
+
+func (d *mergedRootDir) Readdir(count int) ([]os.FileInfo, error) {
+	if d.listed {
+		if count > 0 {
+			return nil, io.EOF
+		}
+		return nil, nil
+	}
+	d.listed = true
+
+	var result []os.FileInfo
+	names := make(map[string]bool)
+	for _, fileSystem := range d.fileSystems {
+		infos, err := readRootDir(fileSystem)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range infos {
+			if info.IsDir() {
+				continue
+			}
+			if names[info.Name()] {
+				return nil, errors.Wrap(ErrDuplicateMigration, info.Name())
+			}
+			names[info.Name()] = true
+			result = append(result, info)
+		}
+	}
+	return result, nil
+}
+
+func (d *mergedRootDir) Stat() (os.FileInfo, error) {
+	return rootDirInfo{}, nil
+}
+
+func (d *mergedRootDir) Read([]byte) (int, error) {
+	return 0, errors.New("can not read directory")
+}
+
+func (d *mergedRootDir) Seek(int64, int) (int64, error) {
+	return 0, errors.New("can not seek directory")
+}
+
+func (d *mergedRootDir) Close() error {
+	return nil
+}
+
+func readRootDir(fileSystem http.FileSystem) ([]os.FileInfo, error) {
+	dir, err := fileSystem.Open("/")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer dir.Close()
+
+	infos, err := dir.Readdir(0)
+	return infos, errors.WithStack(err)
+}
+
+type rootDirInfo struct{}
+
+func (rootDirInfo) Name() string       { return "/" }
+func (rootDirInfo) Size() int64        { return 0 }
+func (rootDirInfo) Mode() os.FileMode  { return os.ModeDir | 0555 }
+func (rootDirInfo) ModTime() time.Time { return time.Time{} }
+func (rootDirInfo) IsDir() bool        { return true }
+func (rootDirInfo) Sys() interface{}   { return nil }
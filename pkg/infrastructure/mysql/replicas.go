@@ -0,0 +1,161 @@
+package mysql
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+const (
+	replicaHealthCheckInterval = 5 * time.Second
+	replicaHealthCheckTimeout  = 2 * time.Second
+)
+
+var ErrReplicasAlreadyOpened = errors.New("replicas are already opened")
+
+type readFromPrimaryKey struct{}
+
+// ReadFromPrimary makes Context reads of ReplicatedClient go to primary, it is used on read-after-write paths
+func ReadFromPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, readFromPrimaryKey{}, true)
+}
+
+func readsFromPrimary(ctx context.Context) bool {
+	value, _ := ctx.Value(readFromPrimaryKey{}).(bool)
+	return value
+}
+
+// ReplicatedClient routes Select and Get to healthy replicas round-robin, everything else including transactions goes to primary.
+// Reads go to primary when there are no healthy replicas
+type ReplicatedClient interface {
+	TransactionalClient
+	Primary() TransactionalClient
+}
+
+type replica struct {
+	db      *sqlx.DB
+	healthy int32
+}
+
+func (r *replica) isHealthy() bool {
+	return atomic.LoadInt32(&r.healthy) == 1
+}
+
+func (r *replica) checkHealth() {
+	ctx, cancel := context.WithTimeout(context.Background(), replicaHealthCheckTimeout)
+	defer cancel()
+
+	var healthy int32
+	if r.db.PingContext(ctx) == nil {
+		healthy = 1
+	}
+	atomic.StoreInt32(&r.healthy, healthy)
+}
+
+func openReplica(dsn DSN, pool PoolConfig) (*replica, error) {
+	db, err := sqlx.Open(dbDriverName, dsn.String())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open replica %s", dsn.Host)
+	}
+	pool.apply(db.DB)
+
+	r := &replica{db: db}
+	r.checkHealth()
+	return r, nil
+}
+
+func runReplicaHealthChecks(replicas []*replica, stopChan chan struct{}) {
+	ticker := time.NewTicker(replicaHealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, r := range replicas {
+				r.checkHealth()
+			}
+		case <-stopChan:
+			return
+		}
+	}
+}
+
+// replicaSet is shared by connector and its replicated clients, so clients see replicas opened after they are made
+type replicaSet struct {
+	lock     sync.RWMutex
+	replicas []*replica
+	next     uint32
+}
+
+// set replaces replicas and returns previous ones
+func (s *replicaSet) set(replicas []*replica) []*replica {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	previous := s.replicas
+	s.replicas = replicas
+	return previous
+}
+
+// healthy returns next healthy replica in round-robin order
+func (s *replicaSet) healthy() (*sqlx.DB, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	n := uint32(len(s.replicas))
+	if n == 0 {
+		return nil, false
+	}
+
+	start := atomic.AddUint32(&s.next, 1)
+	for i := uint32(0); i < n; i++ {
+		r := s.replicas[(start+i)%n]
+		if r.isHealthy() {
+			return r.db, true
+		}
+	}
+	return nil, false
+}
+
+type replicatedClient struct {
+	*transactionalClient
+	replicas *replicaSet
+}
+
+func (c *replicatedClient) Primary() TransactionalClient {
+	return c.transactionalClient
+}
+
+func (c *replicatedClient) Select(dest interface{}, query string, args ...interface{}) error {
+	return c.reader().Select(dest, query, args...)
+}
+
+func (c *replicatedClient) Get(dest interface{}, query string, args ...interface{}) error {
+	return c.reader().Get(dest, query, args...)
+}
+
+func (c *replicatedClient) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return c.contextReader(ctx).SelectContext(ctx, dest, query, args...)
+}
+
+func (c *replicatedClient) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return c.contextReader(ctx).GetContext(ctx, dest, query, args...)
+}
+
+func (c *replicatedClient) contextReader(ctx context.Context) *sqlx.DB {
+	if readsFromPrimary(ctx) {
+		return c.DB
+	}
+	return c.reader()
+}
+
+func (c *replicatedClient) reader() *sqlx.DB {
+	if db, ok := c.replicas.healthy(); ok {
+		return db
+	}
+	return c.DB
+}
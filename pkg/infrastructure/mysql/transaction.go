@@ -0,0 +1,83 @@
+package mysql
+
+import (
+	"context"
+	stderrors "errors"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	driver "github.com/go-sql-driver/mysql"
+	"github.com/pkg/errors"
+)
+
+const (
+	errCodeLockWaitTimeout = 1205
+	errCodeDeadlock        = 1213
+
+	maxTransactionRetries       = 5
+	maxTransactionRetryInterval = time.Second
+)
+
+type TransactionFunc func(tx Transaction) error
+
+// WithTransaction runs fn in transaction, commits it when fn succeeds and rolls back otherwise.
+// Whole fn is retried when transaction fails with deadlock or lock wait timeout.
+// When ctx has transaction, fn joins it without retries, so commit, rollback and retries are left to outer call
+func WithTransaction(ctx context.Context, client TransactionalClient, fn TransactionFunc) error {
+	return WithTransactionOptions(ctx, client, TransactionOptions{}, fn)
+}
+
+func WithTransactionOptions(ctx context.Context, client TransactionalClient, opts TransactionOptions, fn TransactionFunc) error {
+	if tx, ok := TransactionFromContext(ctx); ok {
+		return fn(tx)
+	}
+
+	return backoff.Retry(func() error {
+		err := runTransaction(ctx, client, opts, fn)
+		if err != nil && !IsRetryableError(err) {
+			return backoff.Permanent(err)
+		}
+		return err
+	}, backoff.WithContext(newTransactionBackOff(), ctx))
+}
+
+// IsRetryableError reports whether transaction failed with deadlock or lock wait timeout
+func IsRetryableError(err error) bool {
+	var mysqlErr *driver.MySQLError
+	if !stderrors.As(err, &mysqlErr) {
+		return false
+	}
+	return mysqlErr.Number == errCodeDeadlock || mysqlErr.Number == errCodeLockWaitTimeout
+}
+
+func runTransaction(ctx context.Context, client TransactionalClient, opts TransactionOptions, fn TransactionFunc) (err error) {
+	tx, err := client.BeginTransactionContext(ctx, opts)
+	if err != nil {
+		return errors.Wrap(err, "failed to begin transaction")
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	err = fn(tx)
+	if err != nil {
+		rollbackErr := tx.Rollback()
+		if rollbackErr != nil {
+			err = errors.Wrap(err, rollbackErr.Error())
+		}
+		return err
+	}
+
+	return errors.Wrap(tx.Commit(), "failed to commit transaction")
+}
+
+func newTransactionBackOff() backoff.BackOff {
+	exponentialBackOff := backoff.NewExponentialBackOff()
+	exponentialBackOff.InitialInterval = 50 * time.Millisecond
+	exponentialBackOff.MaxInterval = maxTransactionRetryInterval
+	return backoff.WithMaxRetries(exponentialBackOff, maxTransactionRetries)
+}